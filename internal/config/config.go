@@ -10,43 +10,194 @@ import (
 type Config struct {
 	TelegramConfig TelegramConfig `mapstructure:",squash"`
 	MoodleConfig   MoodleConfig   `mapstructure:",squash"`
+	NotifyConfig   NotifyConfig   `mapstructure:",squash"`
 
-	SyncInterval time.Duration `mapstructure:"SYNC_INTERVAL" validate:"required,min=1"`
-	CsvFilesDir  string        `mapstructure:"CSV_FILES_DIR" validate:"required"`
+	SyncInterval    time.Duration `mapstructure:"SYNC_INTERVAL" validate:"required_without=SyncSchedule,omitempty,min=1"`
+	SyncConcurrency int           `mapstructure:"SYNC_CONCURRENCY" validate:"min=1"`
+	// SyncTimeout bounds a whole sync of one user, retries included.
+	SyncTimeout time.Duration `mapstructure:"SYNC_TIMEOUT" validate:"min=1"`
+	// SyncSchedule is a cron expression; when set it replaces SyncInterval,
+	// which is then optional.
+	SyncSchedule string `mapstructure:"SYNC_SCHEDULE"`
+	// QuietHours is a HH:MM-HH:MM window in which changes are held back.
+	QuietHours string `mapstructure:"QUIET_HOURS"`
+	// QuietHoursFile keeps the changes held back across restarts; empty keeps
+	// them in memory only.
+	QuietHoursFile string `mapstructure:"QUIET_HOURS_FILE"`
+
+	// GPAScale is the letter grade scale, see model.ParseGradeScale. It
+	// defaults to DefaultGradeScale.
+	GPAScale string `mapstructure:"GPA_SCALE" validate:"required"`
+	// GPACredits are the credit hours per course, see model.ParseCredits.
+	GPACredits        string  `mapstructure:"GPA_CREDITS"`
+	GPADefaultCredits float64 `mapstructure:"GPA_DEFAULT_CREDITS" validate:"min=0"`
+
+	UsersFile string `mapstructure:"USERS_FILE" validate:"required"`
+	UsersDir  string `mapstructure:"USERS_DIR" validate:"required"`
+	// UsersKey encrypts the Moodle passwords in USERS_FILE. Without it users
+	// can't log in with a password, only through the web service.
+	UsersKey string `mapstructure:"USERS_KEY"`
+
+	StorageBackend string `mapstructure:"STORAGE_BACKEND" validate:"oneof=csv sqlite"`
+	CsvFilesDir    string `mapstructure:"CSV_FILES_DIR" validate:"required_if=StorageBackend csv"`
+	HistoryDir     string `mapstructure:"HISTORY_DIR" validate:"required_if=StorageBackend csv"`
+	SQLitePath     string `mapstructure:"SQLITE_PATH" validate:"required_if=StorageBackend sqlite"`
 }
 
+// DefaultGradeScale is the 4.0 letter scale GPA_SCALE defaults to.
+const DefaultGradeScale = "A=95:4.0, A-=90:3.67, B+=85:3.33, B=80:3.0, B-=75:2.67, C+=70:2.33, C=65:2.0, C-=60:1.67, D+=55:1.33, D=50:1.0, F=0:0"
+
+const (
+	StorageCSV    = "csv"
+	StorageSQLite = "sqlite"
+)
+
+const (
+	TelegramModePolling = "polling"
+	TelegramModeWebhook = "webhook"
+)
+
+const (
+	NotifyModeInstant = "instant"
+	NotifyModeCourse  = "course"
+	NotifyModeSync    = "sync"
+)
+
+const (
+	MoodleSourceScrape     = "scrape"
+	MoodleSourceWebService = "webservice"
+)
+
 type MoodleConfig struct {
-	MoodleMainPage  string `mapstructure:"MOODLE_MAIN_PAGE" validate:"required,url"`
-	MoodleLoginPage string `mapstructure:"MOODLE_LOGIN_PAGE" validate:"required,url"`
-	MoodleGradePage string `mapstructure:"MOODLE_GRADE_PAGE" validate:"required,url"`
-	MoodleUser      string `mapstructure:"MOODLE_USER" validate:"required"`
-	MoodlePass      string `mapstructure:"MOODLE_PASS" validate:"required"`
+	MoodleSource string `mapstructure:"MOODLE_SOURCE" validate:"oneof=scrape webservice"`
+
+	MoodleMainPage  string `mapstructure:"MOODLE_MAIN_PAGE" validate:"required_if=MoodleSource scrape,omitempty,url"`
+	MoodleLoginPage string `mapstructure:"MOODLE_LOGIN_PAGE" validate:"required_if=MoodleSource scrape,omitempty,url"`
+	MoodleGradePage string `mapstructure:"MOODLE_GRADE_PAGE" validate:"required_if=MoodleSource scrape,omitempty,url"`
+	MoodleUser      string `mapstructure:"MOODLE_USER" validate:"required_if=MoodleSource scrape"`
+	MoodlePass      string `mapstructure:"MOODLE_PASS" validate:"required_if=MoodleSource scrape"`
+	// MoodleCookieFile keeps the scraper session across restarts, empty disables it.
+	MoodleCookieFile string `mapstructure:"MOODLE_COOKIE_FILE"`
+	// MoodleCookieKey encrypts the cookie file when set.
+	MoodleCookieKey string `mapstructure:"MOODLE_COOKIE_KEY"`
+
+	MoodleWebServiceURL string `mapstructure:"MOODLE_WS_URL" validate:"required_if=MoodleSource webservice,omitempty,url"`
+	MoodleToken         string `mapstructure:"MOODLE_TOKEN" validate:"required_if=MoodleSource webservice"`
+
+	MoodleRetryMaxAttempts int           `mapstructure:"MOODLE_RETRY_MAX_ATTEMPTS" validate:"min=1"`
+	MoodleRetryBaseDelay   time.Duration `mapstructure:"MOODLE_RETRY_BASE_DELAY" validate:"min=0"`
+	MoodleRetryMaxDelay    time.Duration `mapstructure:"MOODLE_RETRY_MAX_DELAY" validate:"gtefield=MoodleRetryBaseDelay"`
+	// MoodleRequestTimeout bounds a single HTTP request to Moodle.
+	MoodleRequestTimeout time.Duration `mapstructure:"MOODLE_REQUEST_TIMEOUT" validate:"min=1"`
+
+	// MoodleWorkers is how many courses of one user are fetched in parallel.
+	MoodleWorkers int `mapstructure:"MOODLE_WORKERS" validate:"min=1"`
+	// MoodleRateLimit is the requests per second to Moodle across all users, 0 disables it.
+	MoodleRateLimit float64 `mapstructure:"MOODLE_RATE_LIMIT" validate:"min=0"`
+	MoodleRateBurst int     `mapstructure:"MOODLE_RATE_BURST" validate:"min=1"`
+
+	// MoodleRecordDir and MoodleReplayDir are set by the --record and
+	// --replay flags, not by the environment.
+	MoodleRecordDir string `mapstructure:"-"`
+	MoodleReplayDir string `mapstructure:"-"`
+}
+
+// NotifyConfig enables delivery channels besides Telegram. They receive the
+// changes of the owner account only.
+type NotifyConfig struct {
+	WebhookURL     string `mapstructure:"NOTIFY_WEBHOOK_URL" validate:"omitempty,url"`
+	ChatWebhookURL string `mapstructure:"NOTIFY_CHAT_WEBHOOK_URL" validate:"omitempty,url"`
+
+	SMTPHost string   `mapstructure:"SMTP_HOST"`
+	SMTPPort int      `mapstructure:"SMTP_PORT" validate:"required_with=SMTPHost"`
+	SMTPUser string   `mapstructure:"SMTP_USER"`
+	SMTPPass string   `mapstructure:"SMTP_PASS"`
+	SMTPFrom string   `mapstructure:"SMTP_FROM" validate:"required_with=SMTPHost,omitempty,email"`
+	SMTPTo   []string `mapstructure:"SMTP_TO" validate:"required_with=SMTPHost,dive,email"`
 }
 
 type TelegramConfig struct {
 	TelegramToken string `mapstructure:"TELEGRAM_TOKEN" validate:"required"`
 	TelegramID    int64  `mapstructure:"TELEGRAM_ID" validate:"required,min=1"`
+	// TelegramAllowedIDs are the chats besides TELEGRAM_ID that may /login.
+	TelegramAllowedIDs []int64 `mapstructure:"TELEGRAM_ALLOWED_IDS"`
+
+	// TelegramMode is how updates are received: long polling or a webhook
+	// served by the bot.
+	TelegramMode string `mapstructure:"TELEGRAM_MODE" validate:"oneof=polling webhook"`
+	// TelegramWebhookURL is the public base URL Telegram posts to, e.g. behind a reverse proxy.
+	TelegramWebhookURL    string `mapstructure:"TELEGRAM_WEBHOOK_URL" validate:"required_if=TelegramMode webhook,omitempty,url"`
+	TelegramWebhookPath   string `mapstructure:"TELEGRAM_WEBHOOK_PATH" validate:"startswith=/"`
+	TelegramWebhookPort   int    `mapstructure:"TELEGRAM_WEBHOOK_PORT" validate:"min=0,max=65535"`
+	TelegramWebhookSecret string `mapstructure:"TELEGRAM_WEBHOOK_SECRET" validate:"required_if=TelegramMode webhook"`
+	// The listener serves HTTPS when both files are set, plain HTTP otherwise.
+	TelegramWebhookCertFile string `mapstructure:"TELEGRAM_WEBHOOK_CERT_FILE" validate:"required_with=TelegramWebhookKeyFile"`
+	TelegramWebhookKeyFile  string `mapstructure:"TELEGRAM_WEBHOOK_KEY_FILE" validate:"required_with=TelegramWebhookCertFile"`
+
+	// TelegramQueueFile keeps messages not sent yet across restarts; empty
+	// keeps them in memory only.
+	TelegramQueueFile string `mapstructure:"TELEGRAM_QUEUE_FILE"`
+	// TelegramChatInterval is the minimum time between two messages to the same chat.
+	TelegramChatInterval time.Duration `mapstructure:"TELEGRAM_CHAT_INTERVAL" validate:"min=0"`
+
+	// TelegramNotifyMode is how changes are sent: a message per change, a
+	// digest per course or one digest per sync.
+	TelegramNotifyMode string `mapstructure:"TELEGRAM_NOTIFY_MODE" validate:"oneof=instant course sync"`
 }
 
 func Load() *Config {
-	viper.SetConfigFile(".env")
-	viper.SetConfigType("env")
-	err := viper.ReadInConfig()
+	cfg, err := load(".env")
 	if err != nil {
 		panic(err)
 	}
+	return cfg
+}
+
+func load(path string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("env")
+	v.SetDefault("MOODLE_SOURCE", MoodleSourceScrape)
+	v.SetDefault("MOODLE_RETRY_MAX_ATTEMPTS", 4)
+	v.SetDefault("MOODLE_RETRY_BASE_DELAY", "2s")
+	v.SetDefault("MOODLE_RETRY_MAX_DELAY", "30s")
+	v.SetDefault("MOODLE_REQUEST_TIMEOUT", "30s")
+	v.SetDefault("MOODLE_COOKIE_FILE", "cookies.json")
+	v.SetDefault("MOODLE_WORKERS", 3)
+	v.SetDefault("MOODLE_RATE_LIMIT", 2)
+	v.SetDefault("MOODLE_RATE_BURST", 3)
+	v.SetDefault("STORAGE_BACKEND", StorageCSV)
+	v.SetDefault("HISTORY_DIR", "history")
+	v.SetDefault("SQLITE_PATH", "grades.db")
+	v.SetDefault("TELEGRAM_MODE", TelegramModePolling)
+	v.SetDefault("TELEGRAM_WEBHOOK_PATH", "/telegram/webhook")
+	v.SetDefault("TELEGRAM_WEBHOOK_PORT", 8080)
+	v.SetDefault("TELEGRAM_QUEUE_FILE", "send_queue.json")
+	v.SetDefault("TELEGRAM_CHAT_INTERVAL", "1s")
+	v.SetDefault("TELEGRAM_NOTIFY_MODE", NotifyModeCourse)
+	v.SetDefault("QUIET_HOURS_FILE", "quiet_hours.json")
+	v.SetDefault("SYNC_CONCURRENCY", 2)
+	v.SetDefault("SYNC_TIMEOUT", "10m")
+	v.SetDefault("SMTP_PORT", 587)
+	v.SetDefault("GPA_SCALE", DefaultGradeScale)
+	v.SetDefault("USERS_FILE", "users.json")
+	v.SetDefault("USERS_DIR", "users")
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, err
+	}
 
 	var cfg Config
-	err = viper.Unmarshal(&cfg)
+	err = v.Unmarshal(&cfg)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	validate := validator.New()
 	err = validate.Struct(cfg)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return &cfg
+	return &cfg, nil
 }
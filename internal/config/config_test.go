@@ -0,0 +1,51 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const baseEnv = `TELEGRAM_TOKEN=token
+TELEGRAM_ID=1
+MOODLE_MAIN_PAGE=https://moodle.example.com/my/
+MOODLE_LOGIN_PAGE=https://moodle.example.com/login/index.php
+MOODLE_GRADE_PAGE=https://moodle.example.com/grade/report/overview/index.php
+MOODLE_USER=student
+MOODLE_PASS=secret
+CSV_FILES_DIR=courses
+`
+
+func TestLoad_Sync(t *testing.T) {
+	testcases := []struct {
+		name     string
+		env      string
+		interval time.Duration
+		schedule string
+		err      bool
+	}{
+		{name: "interval", env: "SYNC_INTERVAL=3h\n", interval: 3 * time.Hour},
+		{name: "schedule only", env: "SYNC_SCHEDULE=*/30 8-23 * * mon-fri\n", schedule: "*/30 8-23 * * mon-fri"},
+		{name: "neither", err: true},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".env")
+			require.NoError(t, os.WriteFile(path, []byte(baseEnv+tc.env), 0600))
+
+			cfg, err := load(path)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.interval, cfg.SyncInterval)
+			assert.Equal(t, tc.schedule, cfg.SyncSchedule)
+		})
+	}
+}
@@ -2,6 +2,8 @@ package model
 
 import (
 	"fmt"
+	"html"
+	"strings"
 )
 
 type ChangeType int
@@ -9,32 +11,127 @@ type ChangeType int
 const (
 	NewElement ChangeType = iota
 	Changed
+	Removed
 )
 
+func (tp ChangeType) String() string {
+	switch tp {
+	case NewElement:
+		return "new"
+	case Changed:
+		return "changed"
+	case Removed:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
 type Change struct {
 	TP         ChangeType
+	CourseID   string
 	CourseName string
 	Old        *GradeRow
 	New        *GradeRow
+	// Standing is the course standing after the sync, nil when unknown.
+	Standing *Standing
 }
 
+// ToHTMLString renders the change for Telegram's HTML parse mode; course and
+// item names and feedback are escaped.
 func (ch Change) ToHTMLString() string {
+	return html.EscapeString(ch.CourseName) + "\n" + ch.DetailsHTML()
+}
+
+// DetailsHTML renders the change without the course name, for messages that
+// already name the course.
+func (ch Change) DetailsHTML() string {
+	esc := html.EscapeString
 	var s string
 	switch ch.TP {
 	case NewElement:
-		s = fmt.Sprintf("%s\n🔆 <i>New:</i> %s",
-			ch.CourseName, ch.New.StringWithName())
+		s = fmt.Sprintf("🔆 <i>New:</i> %s", esc(ch.New.StringWithName()))
 	case Changed:
-		s = fmt.Sprintf("%s\n❇️ <i>Changes</i> in %s\nOld: <s>%s</s>\nNew: %s",
+		s = fmt.Sprintf("❇️ <i>Changes</i> in %s\nOld: <s>%s</s>\nNew: %s",
+			esc(ch.Old.AssName), esc(ch.Old.StringWithoutName()), esc(ch.New.StringWithoutName()))
+	case Removed:
+		s = fmt.Sprintf("🚫 <i>Removed:</i> <s>%s</s>", esc(ch.Old.StringWithName()))
+	default:
+		panic("unknown change type")
+	}
+
+	if ch.New != nil && ch.New.Feedback != "" {
+		s += fmt.Sprintf("\n<i>Feedback:</i> %s", esc(ch.New.Feedback))
+	}
+
+	return s
+}
+
+// ToPlainString renders the change without markup, for channels other than Telegram.
+func (ch Change) ToPlainString() string {
+	var s string
+	switch ch.TP {
+	case NewElement:
+		s = fmt.Sprintf("%s\nNew: %s", ch.CourseName, ch.New.StringWithName())
+	case Changed:
+		s = fmt.Sprintf("%s\nChanges in %s\nOld: %s\nNew: %s",
 			ch.CourseName, ch.Old.AssName,
 			ch.Old.StringWithoutName(), ch.New.StringWithoutName())
+	case Removed:
+		s = fmt.Sprintf("%s\nRemoved: %s", ch.CourseName, ch.Old.StringWithName())
 	default:
 		panic("unknown change type")
 	}
 
-	if ch.New.Feedback != "" {
-		s += fmt.Sprintf("\n<i>Feedback:</i> %s", ch.New.Feedback)
+	if ch.New != nil && ch.New.Feedback != "" {
+		s += fmt.Sprintf("\nFeedback: %s", ch.New.Feedback)
 	}
 
 	return s
 }
+
+func (ch Change) ItemName() string {
+	if ch.New != nil {
+		return ch.New.AssName
+	}
+	if ch.Old != nil {
+		return ch.Old.AssName
+	}
+	return ""
+}
+
+// GroupByCourse splits changes by course, keeping the order in which the
+// courses first appear.
+func GroupByCourse(changes []Change) [][]Change {
+	var groups [][]Change
+	index := map[string]int{}
+	for _, ch := range changes {
+		key := ch.CourseID + "\x00" + ch.CourseName
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], ch)
+	}
+	return groups
+}
+
+// Summary counts the changes by type, e.g. "2 new, 1 changed".
+func Summary(changes []Change) string {
+	var counts [Removed + 1]int
+	for _, ch := range changes {
+		if ch.TP >= NewElement && ch.TP <= Removed {
+			counts[ch.TP]++
+		}
+	}
+
+	var parts []string
+	for tp, n := range counts {
+		if n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", n, ChangeType(tp)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
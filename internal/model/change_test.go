@@ -1,5 +1,12 @@
 package model
 
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
 // func TestChange_ToHTMLString(t *testing.T) {
 // 	testcases := []struct {
 // 		name     string
@@ -35,3 +42,40 @@ package model
 // 		})
 // 	}
 // }
+
+func TestGroupByCourse(t *testing.T) {
+	quiz := NewGradeRow([]string{"Quiz 1", "10.00 %", "8.00", "0–10", "80.00 %"})
+	changes := []Change{
+		{TP: NewElement, CourseID: "101", CourseName: "Calculus II", New: quiz},
+		{TP: Removed, CourseID: "202", CourseName: "Discrete Mathematics", Old: quiz},
+		{TP: Changed, CourseID: "101", CourseName: "Calculus II", Old: quiz, New: quiz},
+	}
+
+	groups := GroupByCourse(changes)
+	require.Len(t, groups, 2)
+	assert.Equal(t, []Change{changes[0], changes[2]}, groups[0])
+	assert.Equal(t, []Change{changes[1]}, groups[1])
+	assert.Empty(t, GroupByCourse(nil))
+}
+
+func TestSummary(t *testing.T) {
+	testcases := []struct {
+		name     string
+		types    []ChangeType
+		expected string
+	}{
+		{name: "empty", expected: ""},
+		{name: "one type", types: []ChangeType{NewElement, NewElement}, expected: "2 new"},
+		{name: "mixed", types: []ChangeType{Removed, NewElement, Changed, NewElement}, expected: "2 new, 1 changed, 1 removed"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var changes []Change
+			for _, tp := range tc.types {
+				changes = append(changes, Change{TP: tp})
+			}
+			assert.Equal(t, tc.expected, Summary(changes))
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package model
+
+// Course is a single course as reported by a grade source.
+type Course struct {
+	ID   string
+	Name string
+	URL  string
+}
@@ -0,0 +1,296 @@
+package model
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LetterGrade is one step of a grade scale: a course total of at least Min
+// percent earns Letter and Points.
+type LetterGrade struct {
+	Letter string
+	Min    float64
+	Points float64
+}
+
+// GradeScale maps course totals to letter grades, highest Min first.
+type GradeScale []LetterGrade
+
+// ParseGradeScale parses a comma separated list of "Letter=Min:Points", e.g.
+// "A=95:4.0, A-=90:3.67, F=0:0". The order of the steps does not matter.
+func ParseGradeScale(s string) (GradeScale, error) {
+	var scale GradeScale
+	for entry := range strings.SplitSeq(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		letter, rest, ok1 := strings.Cut(entry, "=")
+		lo, points, ok2 := strings.Cut(rest, ":")
+		letter = strings.TrimSpace(letter)
+		loV, ok3 := parseNumber(lo)
+		pointsV, ok4 := parseNumber(points)
+		if !ok1 || !ok2 || !ok3 || !ok4 || letter == "" {
+			return nil, fmt.Errorf("invalid grade scale entry %q, want Letter=Min:Points", entry)
+		}
+		scale = append(scale, LetterGrade{Letter: letter, Min: loV, Points: pointsV})
+	}
+	if len(scale) == 0 {
+		return nil, errors.New("empty grade scale")
+	}
+
+	slices.SortFunc(scale, func(a, b LetterGrade) int {
+		switch {
+		case a.Min > b.Min:
+			return -1
+		case a.Min < b.Min:
+			return 1
+		}
+		return 0
+	})
+	for i := 1; i < len(scale); i++ {
+		if scale[i].Min == scale[i-1].Min {
+			return nil, fmt.Errorf("grade scale has %s and %s both from %s%%", scale[i-1].Letter, scale[i].Letter, FormatNumber(scale[i].Min))
+		}
+	}
+	return scale, nil
+}
+
+// Grade returns the letter grade of a course total in percent. It is false
+// when the total is below every step.
+func (s GradeScale) Grade(percent float64) (LetterGrade, bool) {
+	for _, lg := range s {
+		if percent >= lg.Min {
+			return lg, true
+		}
+	}
+	return LetterGrade{}, false
+}
+
+// Credits are the credit hours of courses, keyed by course id or by a part
+// of the course name.
+type Credits map[string]float64
+
+// ParseCredits parses a semicolon separated list of "course=credits", e.g.
+// "Calculus II=4; Physics II=4; 12345=3". Semicolons are used since course
+// names often contain commas.
+func ParseCredits(s string) (Credits, error) {
+	credits := Credits{}
+	for entry := range strings.SplitSeq(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(entry, "=")
+		key = strings.TrimSpace(key)
+		v, ok2 := parseNumber(value)
+		if !ok || !ok2 || key == "" || v < 0 {
+			return nil, fmt.Errorf("invalid credits entry %q, want course=credits", entry)
+		}
+		credits[strings.ToLower(key)] = v
+	}
+	return credits, nil
+}
+
+// For returns the credits of a course. A key equal to the course id wins,
+// otherwise the longest key the course name contains (case-insensitive).
+func (c Credits) For(course Course) (float64, bool) {
+	if v, ok := c[strings.ToLower(course.ID)]; ok {
+		return v, true
+	}
+
+	name := strings.ToLower(course.Name)
+	best, found := "", false
+	for key := range c {
+		if strings.Contains(name, key) && (!found || len(key) > len(best) || len(key) == len(best) && key < best) {
+			best, found = key, true
+		}
+	}
+	return c[best], found
+}
+
+// termPattern finds a semester in a course name, e.g. "Fall 2025" or
+// "2025 Spring".
+var termPattern = regexp.MustCompile(`(?i)\b(?:(winter|spring|summer|fall|autumn)\W{0,3}((?:19|20)\d\d)|((?:19|20)\d\d)\W{0,3}(winter|spring|summer|fall|autumn))\b`)
+
+// seasons order the semesters of a year.
+var seasons = map[string]int{"winter": 0, "spring": 1, "summer": 2, "fall": 3, "autumn": 3}
+
+// Term is a semester, e.g. Fall 2025.
+type Term struct {
+	Season string
+	Year   int
+}
+
+// ParseTerm finds a semester in s, such as a course name like "Calculus II
+// (Fall 2025)". Autumn is the same term as Fall.
+func ParseTerm(s string) (Term, bool) {
+	m := termPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Term{}, false
+	}
+	season, year := m[1], m[2]
+	if season == "" {
+		season, year = m[4], m[3]
+	}
+	season = strings.ToLower(season)
+	if season == "autumn" {
+		season = "fall"
+	}
+	y, _ := strconv.Atoi(year)
+	return Term{Season: strings.ToUpper(season[:1]) + season[1:], Year: y}, true
+}
+
+func (t Term) String() string {
+	return fmt.Sprintf("%s %d", t.Season, t.Year)
+}
+
+// Before reports whether t is an earlier semester than other.
+func (t Term) Before(other Term) bool {
+	if t.Year != other.Year {
+		return t.Year < other.Year
+	}
+	return seasons[strings.ToLower(t.Season)] < seasons[strings.ToLower(other.Season)]
+}
+
+// ScopeTerm picks the courses a GPA is computed over. An empty query picks
+// the latest semester found in the course names, or every course when none
+// has one; "all" picks every course. Any other query is a semester like
+// "Fall 2025", or else a part of the course names. It returns the label of
+// the scope, empty for every course, and false when no course matches.
+func ScopeTerm(courses []CourseGrades, query string) ([]CourseGrades, string, bool) {
+	query = strings.TrimSpace(query)
+	if strings.EqualFold(query, "all") {
+		return courses, "", true
+	}
+	if query == "" {
+		var latest Term
+		found := false
+		for _, cg := range courses {
+			if t, ok := ParseTerm(cg.Course.Name); ok && (!found || latest.Before(t)) {
+				latest, found = t, true
+			}
+		}
+		if !found {
+			return courses, "", true
+		}
+		query = latest.String()
+	}
+
+	term, isTerm := ParseTerm(query)
+	label := query
+	if isTerm {
+		label = term.String()
+	}
+
+	var scoped []CourseGrades
+	for _, cg := range courses {
+		t, ok := ParseTerm(cg.Course.Name)
+		if isTerm && ok && t == term || !isTerm && strings.Contains(strings.ToLower(cg.Course.Name), strings.ToLower(query)) {
+			scoped = append(scoped, cg)
+		}
+	}
+	return scoped, label, len(scoped) > 0
+}
+
+// GPAConfig is how course totals turn into a GPA.
+type GPAConfig struct {
+	Scale   GradeScale
+	Credits Credits
+	// DefaultCredits are used for courses missing from Credits; courses with
+	// no credits are listed but not counted.
+	DefaultCredits float64
+}
+
+// CourseGrades are the stored rows of a course.
+type CourseGrades struct {
+	Course Course
+	Rows   []*GradeRow
+}
+
+// CourseGPA is the grade of one course.
+type CourseGPA struct {
+	Course Course
+	// Percent is Moodle's course total, or the standing of the graded items
+	// when Moodle reports none.
+	Percent float64
+	// Graded is false when the course has nothing graded yet or the scale
+	// has no grade for its total.
+	Graded  bool
+	Grade   LetterGrade
+	Credits float64
+}
+
+// Counted reports whether the course is part of the GPA.
+func (c CourseGPA) Counted() bool {
+	return c.Graded && c.Credits > 0
+}
+
+// GPA is the credit weighted grade point average of a semester.
+type GPA struct {
+	// Term is the semester the GPA covers, empty for every course.
+	Term    string
+	Courses []CourseGPA
+	// Credits are the credits of the counted courses.
+	Credits float64
+	Value   float64
+}
+
+// ComputeGPA grades every course by its total percentage and averages the
+// grade points weighted by credits.
+func ComputeGPA(courses []CourseGrades, cfg GPAConfig) GPA {
+	var gpa GPA
+	var points float64
+	for _, cg := range courses {
+		c := CourseGPA{Course: cg.Course, Credits: cfg.DefaultCredits}
+		if v, ok := cfg.Credits.For(cg.Course); ok {
+			c.Credits = v
+		}
+
+		st, ok := ComputeStanding(cg.Rows)
+		switch {
+		case st.Reported.IsGraded():
+			c.Percent, c.Graded = st.Reported.Value, true
+		case ok && st.Graded > 0:
+			c.Percent, c.Graded = st.Current, true
+		}
+		if c.Graded {
+			c.Grade, c.Graded = cfg.Scale.Grade(c.Percent)
+		}
+
+		if c.Counted() {
+			gpa.Credits += c.Credits
+			points += c.Grade.Points * c.Credits
+		}
+		gpa.Courses = append(gpa.Courses, c)
+	}
+
+	if gpa.Credits > 0 {
+		gpa.Value = points / gpa.Credits
+	}
+	return gpa
+}
+
+// WriteCSV writes a row per course and a final GPA row, for spreadsheets.
+func (g GPA) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{{"Course", "Percent", "Letter", "Points", "Credits", "Counted"}}
+	for _, c := range g.Courses {
+		record := []string{c.Course.Name, "", "", "", FormatNumber(c.Credits), fmt.Sprint(c.Counted())}
+		if c.Graded {
+			record[1] = FormatNumber(c.Percent)
+			record[2] = c.Grade.Letter
+			record[3] = FormatNumber(c.Grade.Points)
+		}
+		records = append(records, record)
+	}
+	records = append(records, []string{"GPA", "", "", FormatNumber(g.Value), FormatNumber(g.Credits), ""})
+
+	return cw.WriteAll(records)
+}
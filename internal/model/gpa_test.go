@@ -0,0 +1,173 @@
+package model
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGradeScale(t *testing.T) {
+	scale, err := ParseGradeScale(config.DefaultGradeScale)
+	require.NoError(t, err)
+	require.Len(t, scale, 11)
+
+	testcases := []struct {
+		percent  float64
+		expected string
+	}{
+		{percent: 100, expected: "A"},
+		{percent: 95, expected: "A"},
+		{percent: 94.99, expected: "A-"},
+		{percent: 80, expected: "B"},
+		{percent: 50, expected: "D"},
+		{percent: 12, expected: "F"},
+	}
+	for _, tc := range testcases {
+		lg, ok := scale.Grade(tc.percent)
+		assert.True(t, ok)
+		assert.Equal(t, tc.expected, lg.Letter, "%v%%", tc.percent)
+	}
+
+	unordered, err := ParseGradeScale("Pass=50:1, Distinction=85:4, Merit=70:3")
+	require.NoError(t, err)
+	assert.Equal(t, GradeScale{{"Distinction", 85, 4}, {"Merit", 70, 3}, {"Pass", 50, 1}}, unordered)
+	_, ok := unordered.Grade(49)
+	assert.False(t, ok, "below every step")
+
+	for _, bad := range []string{"", "A=95", "A=x:4", "=95:4", "A=90:4, B=90:3"} {
+		_, err := ParseGradeScale(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestCredits(t *testing.T) {
+	credits, err := ParseCredits("Calculus II=4; physics=3; Physics II Lab=1; 777=2,5")
+	require.NoError(t, err)
+
+	testcases := []struct {
+		name     string
+		course   Course
+		expected float64
+		found    bool
+	}{
+		{name: "name", course: Course{ID: "1", Name: "Calculus II-Lecture"}, expected: 4, found: true},
+		{name: "longest key wins", course: Course{ID: "2", Name: "Physics II Lab"}, expected: 1, found: true},
+		{name: "case-insensitive", course: Course{ID: "3", Name: "PHYSICS I"}, expected: 3, found: true},
+		{name: "id", course: Course{ID: "777", Name: "History"}, expected: 2.5, found: true},
+		{name: "missing", course: Course{ID: "4", Name: "History"}},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, ok := credits.For(tc.course)
+			assert.Equal(t, tc.found, ok)
+			assert.Equal(t, tc.expected, v)
+		})
+	}
+
+	_, err = ParseCredits("Calculus=four")
+	assert.Error(t, err)
+}
+
+func TestComputeGPA(t *testing.T) {
+	scale, err := ParseGradeScale(config.DefaultGradeScale)
+	require.NoError(t, err)
+	cfg := GPAConfig{Scale: scale, Credits: Credits{"calculus": 4, "history": 0}, DefaultCredits: 2}
+
+	calculus := CourseGrades{Course: Course{ID: "1", Name: "Calculus"}, Rows: []*GradeRow{
+		row("Calculus", ItemRow, "Quiz", "", "9.00", "0–10", "90.00 %"),
+		row("Calculus", CourseTotalRow, "Course total", "", "91.00", "0–100", "91.00 %"),
+	}}
+	physics := CourseGrades{Course: Course{ID: "2", Name: "Physics"}, Rows: []*GradeRow{
+		row("Physics", ItemRow, "Lab", "", "7.50", "0–10", "75.00 %"),
+	}}
+	history := CourseGrades{Course: Course{ID: "3", Name: "History"}, Rows: []*GradeRow{
+		row("History", ItemRow, "Essay", "", "20.00", "0–20", "100.00 %"),
+	}}
+	art := CourseGrades{Course: Course{ID: "4", Name: "Art"}, Rows: []*GradeRow{
+		row("Art", ItemRow, "Sketch", "", "-", "0–10", "-"),
+	}}
+
+	gpa := ComputeGPA([]CourseGrades{calculus, physics, history, art}, cfg)
+	require.Len(t, gpa.Courses, 4)
+
+	assert.Equal(t, "A-", gpa.Courses[0].Grade.Letter, "Moodle's total wins")
+	assert.InDelta(t, 91, gpa.Courses[0].Percent, 1e-9)
+	assert.Equal(t, "B-", gpa.Courses[1].Grade.Letter)
+	assert.Equal(t, 2.0, gpa.Courses[1].Credits, "default credits")
+	assert.False(t, gpa.Courses[2].Counted(), "no credits")
+	assert.False(t, gpa.Courses[3].Graded)
+
+	assert.Equal(t, 6.0, gpa.Credits)
+	assert.InDelta(t, (3.67*4+2.67*2)/6, gpa.Value, 1e-9)
+
+	var buf bytes.Buffer
+	require.NoError(t, gpa.WriteCSV(&buf))
+	assert.Equal(t, "Course,Percent,Letter,Points,Credits,Counted\n"+
+		"Calculus,91,A-,3.67,4,true\n"+
+		"Physics,75,B-,2.67,2,true\n"+
+		"History,100,A,4,0,false\n"+
+		"Art,,,,2,false\n"+
+		"GPA,,,3.34,6,\n", buf.String())
+}
+
+func TestParseTerm(t *testing.T) {
+	testcases := []struct {
+		name     string
+		expected Term
+		found    bool
+	}{
+		{name: "Calculus II (Fall 2025)", expected: Term{"Fall", 2025}, found: true},
+		{name: "PHYS 161 - spring 2026", expected: Term{"Spring", 2026}, found: true},
+		{name: "2025 Autumn: History", expected: Term{"Fall", 2025}, found: true},
+		{name: "Summer-2024 Lab", expected: Term{"Summer", 2024}, found: true},
+		{name: "Calculus II"},
+		{name: "Springfield 2025"},
+	}
+	for _, tc := range testcases {
+		term, ok := ParseTerm(tc.name)
+		assert.Equal(t, tc.found, ok, tc.name)
+		assert.Equal(t, tc.expected, term, tc.name)
+	}
+
+	assert.True(t, Term{"Fall", 2025}.Before(Term{"Spring", 2026}))
+	assert.True(t, Term{"Spring", 2026}.Before(Term{"Fall", 2026}))
+	assert.False(t, Term{"Fall", 2026}.Before(Term{"Fall", 2026}))
+}
+
+func TestScopeTerm(t *testing.T) {
+	course := func(name string) CourseGrades {
+		return CourseGrades{Course: Course{Name: name}}
+	}
+	calculus := course("Calculus II (Spring 2026)")
+	physics := course("Physics II (Spring 2026)")
+	history := course("History (Fall 2025)")
+	seminar := course("Research seminar")
+	courses := []CourseGrades{history, calculus, seminar, physics}
+
+	testcases := []struct {
+		name     string
+		courses  []CourseGrades
+		query    string
+		expected []CourseGrades
+		label    string
+		found    bool
+	}{
+		{name: "latest term", courses: courses, expected: []CourseGrades{calculus, physics}, label: "Spring 2026", found: true},
+		{name: "term", courses: courses, query: "fall 2025", expected: []CourseGrades{history}, label: "Fall 2025", found: true},
+		{name: "all", courses: courses, query: "ALL", expected: courses, found: true},
+		{name: "name", courses: courses, query: "seminar", expected: []CourseGrades{seminar}, label: "seminar", found: true},
+		{name: "no terms", courses: []CourseGrades{seminar}, expected: []CourseGrades{seminar}, found: true},
+		{name: "no match", courses: courses, query: "Summer 2026", label: "Summer 2026"},
+	}
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			scoped, label, ok := ScopeTerm(tc.courses, tc.query)
+			assert.Equal(t, tc.found, ok)
+			assert.Equal(t, tc.label, label)
+			assert.Equal(t, tc.expected, scoped)
+		})
+	}
+}
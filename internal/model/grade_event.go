@@ -0,0 +1,98 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// GradeEvent is a single observed change of a grade item, as kept in the
+// grade history.
+type GradeEvent struct {
+	ObservedAt time.Time
+	CourseID   string
+	CourseName string
+	TP         ChangeType
+	ItemName   string
+	Old        *GradeRow
+	New        *GradeRow
+}
+
+// gradeEventFields is the minimal record length; records shorter than
+// gradeEventFields+1 have no course ID.
+const gradeEventFields = 11
+
+func NewGradeEvent(ch Change, observedAt time.Time) GradeEvent {
+	return GradeEvent{
+		ObservedAt: observedAt,
+		CourseID:   ch.CourseID,
+		CourseName: ch.CourseName,
+		TP:         ch.TP,
+		ItemName:   ch.ItemName(),
+		Old:        ch.Old,
+		New:        ch.New,
+	}
+}
+
+// ParseGradeEvent is the inverse of GradeEvent.ToStringSlice.
+func ParseGradeEvent(record []string) (GradeEvent, error) {
+	if len(record) < gradeEventFields {
+		return GradeEvent{}, fmt.Errorf("grade event record has %d fields, want %d", len(record), gradeEventFields)
+	}
+
+	observedAt, err := time.Parse(time.RFC3339, record[0])
+	if err != nil {
+		return GradeEvent{}, fmt.Errorf("invalid grade event time: %v", err)
+	}
+
+	tp, err := strconv.Atoi(record[2])
+	if err != nil {
+		return GradeEvent{}, fmt.Errorf("invalid grade event type: %v", err)
+	}
+
+	ev := GradeEvent{
+		ObservedAt: observedAt,
+		CourseName: record[1],
+		TP:         ChangeType(tp),
+		ItemName:   record[3],
+	}
+	if len(record) > gradeEventFields {
+		ev.CourseID = record[gradeEventFields]
+	}
+	if ev.TP != NewElement {
+		ev.Old = eventRow(ev.ItemName, record[4], record[5], record[6], "")
+	}
+	if ev.TP != Removed {
+		ev.New = eventRow(ev.ItemName, record[7], record[8], record[9], record[10])
+	}
+	return ev, nil
+}
+
+func eventRow(name, score, rang, percentage, feedback string) *GradeRow {
+	raw := make([]string, NumColumns)
+	raw[ColName] = name
+	raw[ColScore] = score
+	raw[ColRange] = rang
+	raw[ColPercentage] = percentage
+	raw[ColFeedback] = feedback
+	return NewGradeRow(raw)
+}
+
+func (ev GradeEvent) ToStringSlice() []string {
+	record := []string{
+		ev.ObservedAt.Format(time.RFC3339),
+		ev.CourseName,
+		strconv.Itoa(int(ev.TP)),
+		ev.ItemName,
+		"", "", "",
+		"", "", "", "",
+		ev.CourseID,
+	}
+	if ev.Old != nil {
+		record[4], record[5], record[6] = ev.Old.Score, ev.Old.Rang, ev.Old.Percentage
+	}
+	if ev.New != nil {
+		record[7], record[8], record[9], record[10] = ev.New.Score, ev.New.Rang, ev.New.Percentage, ev.New.Feedback
+	}
+	return record
+}
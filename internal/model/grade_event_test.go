@@ -0,0 +1,45 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGradeEvent_Record(t *testing.T) {
+	observedAt := time.Date(2025, 3, 1, 12, 30, 0, 0, time.UTC)
+	old := NewGradeRow([]string{"Quiz", "", "5.00", "0–10", "50.00 %"})
+	new := NewGradeRow([]string{"Quiz", "", "7.00", "0–10", "70.00 %", "Regraded"})
+
+	testcases := []struct {
+		name   string
+		change Change
+	}{
+		{name: "new", change: Change{TP: NewElement, CourseID: "42", CourseName: "Calculus", New: new}},
+		{name: "changed", change: Change{TP: Changed, CourseID: "42", CourseName: "Calculus", Old: old, New: new}},
+		{name: "removed", change: Change{TP: Removed, CourseID: "42", CourseName: "Calculus", Old: old}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			ev := NewGradeEvent(tc.change, observedAt)
+
+			parsed, err := ParseGradeEvent(ev.ToStringSlice())
+			require.NoError(t, err)
+			assert.True(t, parsed.ObservedAt.Equal(observedAt))
+			assert.Equal(t, ev.CourseID, parsed.CourseID)
+			assert.Equal(t, ev.CourseName, parsed.CourseName)
+			assert.Equal(t, ev.TP, parsed.TP)
+			assert.Equal(t, "Quiz", parsed.ItemName)
+			if ev.Old != nil {
+				assert.True(t, ev.Old.IsEqual(parsed.Old))
+			}
+			if ev.New != nil {
+				assert.True(t, ev.New.IsEqual(parsed.New))
+				assert.Equal(t, ev.New.Feedback, parsed.New.Feedback)
+			}
+		})
+	}
+}
@@ -5,29 +5,101 @@ import (
 	"strings"
 )
 
+// Column is a position in the canonical GradeRow layout. Raw rows, CSV
+// snapshots and every grade source use this order, whatever columns the
+// Moodle report itself shows.
+type Column int
+
+const (
+	ColName Column = iota
+	ColWeight
+	ColScore
+	ColRange
+	ColPercentage
+	ColFeedback
+	ColContribution
+	ColLetterGrade
+	ColRank
+	ColAverage
+	ColKind
+	ColCategory
+
+	NumColumns = int(ColCategory) + 1
+)
+
+// RowKind tells grade items from the totals Moodle aggregates from them.
+type RowKind string
+
+const (
+	ItemRow          RowKind = ""
+	CategoryTotalRow RowKind = "category"
+	CourseTotalRow   RowKind = "course"
+)
+
+// CategorySeparator joins the names of nested categories in GradeRow.Category.
+const CategorySeparator = " / "
+
 type GradeRow struct {
-	AssName    string
-	Percentage string
-	Score      string
-	Rang       string
-	Feedback   string
-	Raw        []string
+	AssName      string
+	Weight       string
+	Percentage   string
+	Score        string
+	Rang         string
+	Feedback     string
+	Contribution string
+	LetterGrade  string
+	Rank         string
+	Average      string
+	Kind         RowKind
+	// Category is the path of the category the row belongs to, e.g.
+	// "Calculus II / Homework"; for totals it is the category they total.
+	Category string
+	Raw      []string
+
+	// Parsed from the columns above.
+	ScoreValue   GradeValue
+	RangeValue   GradeRange
+	PercentValue GradeValue
+	WeightValue  GradeValue
 }
 
+// NewGradeRow builds a row from the canonical layout. Missing trailing
+// columns are left empty.
 func NewGradeRow(raw []string) *GradeRow {
-	if len(raw) < 5 {
-		panic("raw must have at least 5 elements")
+	if len(raw) == 0 {
+		panic("raw must have at least the name column")
+	}
+	if len(raw) < NumColumns {
+		padded := make([]string, NumColumns)
+		copy(padded, raw)
+		raw = padded
 	}
 	return &GradeRow{
-		AssName:    raw[0],
-		Percentage: raw[4],
-		Score:      raw[2],
-		Rang:       raw[3],
-		Feedback:   raw[5],
-		Raw:        raw,
+		AssName:      raw[ColName],
+		Weight:       raw[ColWeight],
+		Percentage:   raw[ColPercentage],
+		Score:        raw[ColScore],
+		Rang:         raw[ColRange],
+		Feedback:     raw[ColFeedback],
+		Contribution: raw[ColContribution],
+		LetterGrade:  raw[ColLetterGrade],
+		Rank:         raw[ColRank],
+		Average:      raw[ColAverage],
+		Kind:         RowKind(raw[ColKind]),
+		Category:     raw[ColCategory],
+		Raw:          raw,
+		ScoreValue:   ParseGradeValue(raw[ColScore]),
+		RangeValue:   ParseGradeRange(raw[ColRange]),
+		PercentValue: ParseGradeValue(raw[ColPercentage]),
+		WeightValue:  ParseGradeValue(raw[ColWeight]),
 	}
 }
 
+// IsTotal reports whether the row is a category or course total.
+func (gr *GradeRow) IsTotal() bool {
+	return gr.Kind != ItemRow
+}
+
 func (gr *GradeRow) ToStringSlice() []string {
 	return gr.Raw
 }
@@ -40,13 +112,22 @@ func (gr *GradeRow) StringWithName() string {
 }
 
 func (gr *GradeRow) ScoreWithSlash() string {
-	got := gr.Score
 	from := gr.Rang
-	if splited := strings.Split(from, "–"); len(splited) == 2 {
-		from = TrimWhiteSpace(splited[1])
+	if gr.RangeValue.Valid {
+		from = FormatNumber(gr.RangeValue.Max)
 	}
 
-	return got + "/" + from
+	return gr.Score + "/" + from
+}
+
+// Fraction returns the score as a share of the range, e.g. 0.8 for 8 out of
+// 0–10. It is false when the item isn't graded or has no usable range.
+func (gr *GradeRow) Fraction() (float64, bool) {
+	if !gr.ScoreValue.IsGraded() || !gr.RangeValue.Valid || gr.RangeValue.Max == gr.RangeValue.Min {
+		return 0, false
+	}
+	r := gr.RangeValue
+	return (gr.ScoreValue.Value - r.Min) / (r.Max - r.Min), true
 }
 
 //go:inline
@@ -54,6 +135,12 @@ func TrimWhiteSpace(s string) string {
 	return strings.ReplaceAll(s, " ", "")
 }
 
+// IsEqual compares the parsed values, so a report switching between "8.00"
+// and "8,00" is not a change.
 func (gr *GradeRow) IsEqual(other *GradeRow) bool {
-	return gr.AssName == other.AssName && gr.Percentage == other.Percentage && gr.Score == other.Score && gr.Rang == other.Rang
+	return gr.AssName == other.AssName &&
+		gr.PercentValue.Equal(other.PercentValue) &&
+		gr.ScoreValue.Equal(other.ScoreValue) &&
+		gr.RangeValue == other.RangeValue &&
+		(gr.RangeValue.Valid || gr.Rang == other.Rang)
 }
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGradeRow_IsEqual(t *testing.T) {
+	quiz := NewGradeRow([]string{"Quiz 1", "10.00 %", "8.00", "0–10", "80.00 %"})
+
+	testcases := []struct {
+		name     string
+		other    []string
+		expected bool
+	}{
+		{name: "same", other: []string{"Quiz 1", "10.00 %", "8.00", "0–10", "80.00 %"}, expected: true},
+		{name: "decimal comma", other: []string{"Quiz 1", "10,00 %", "8,00", "0,00–10,00", "80,00 %"}, expected: true},
+		{name: "regraded", other: []string{"Quiz 1", "10.00 %", "9.00", "0–10", "90.00 %"}, expected: false},
+		{name: "ungraded", other: []string{"Quiz 1", "10.00 %", "-", "0–10", "-"}, expected: false},
+		{name: "range", other: []string{"Quiz 1", "10.00 %", "8.00", "0–20", "80.00 %"}, expected: false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, quiz.IsEqual(NewGradeRow(tc.other)))
+		})
+	}
+}
+
+func TestGradeRow_Fraction(t *testing.T) {
+	f, ok := NewGradeRow([]string{"Quiz 1", "", "7,5", "0–10", ""}).Fraction()
+	assert.True(t, ok)
+	assert.InDelta(t, 0.75, f, 1e-9)
+
+	_, ok = NewGradeRow([]string{"Midterm", "", "-", "0–100", "-"}).Fraction()
+	assert.False(t, ok)
+
+	assert.Equal(t, "8.00/10", NewGradeRow([]string{"Quiz 1", "", "8.00", "0.00–10.00", ""}).ScoreWithSlash())
+}
@@ -0,0 +1,161 @@
+package model
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// GradeState tells what a grade cell holds.
+type GradeState int
+
+const (
+	// NotGraded is an empty cell or Moodle's "-". It is the zero value.
+	NotGraded GradeState = iota
+	// Graded is a number.
+	Graded
+	// Unparsed is text that isn't a number, e.g. a letter or "Pass".
+	Unparsed
+)
+
+// GradeValue is a number parsed from a grade cell such as "8.50",
+// "80,00 %" or "-".
+type GradeValue struct {
+	Value float64
+	State GradeState
+	// Text is the trimmed cell, used for Unparsed values.
+	Text string
+}
+
+var notGradedTexts = []string{"", "-", "–", "—", "not graded", "ungraded", "n/a"}
+
+// ParseGradeValue parses a score, percentage or weight cell. A percent sign
+// is dropped and both "8.5" and "8,5" are read as 8.5.
+func ParseGradeValue(s string) GradeValue {
+	text := strings.TrimSpace(strings.Map(normalizeSpace, s))
+	for _, ng := range notGradedTexts {
+		if strings.EqualFold(text, ng) {
+			return GradeValue{State: NotGraded, Text: text}
+		}
+	}
+
+	v, ok := parseNumber(strings.TrimSuffix(text, "%"))
+	if !ok {
+		return GradeValue{State: Unparsed, Text: text}
+	}
+	return GradeValue{Value: v, State: Graded, Text: text}
+}
+
+func (v GradeValue) IsGraded() bool {
+	return v.State == Graded
+}
+
+// Equal compares numbers, so "8.00" equals "8,0".
+func (v GradeValue) Equal(other GradeValue) bool {
+	if v.State != other.State {
+		return false
+	}
+	switch v.State {
+	case Graded:
+		return v.Value == other.Value
+	case Unparsed:
+		return v.Text == other.Text
+	default:
+		return true
+	}
+}
+
+// String formats the number without trailing zeros, "-" when not graded.
+func (v GradeValue) String() string {
+	switch v.State {
+	case Graded:
+		return FormatNumber(v.Value)
+	case NotGraded:
+		return "-"
+	default:
+		return v.Text
+	}
+}
+
+// GradeRange is the min–max range of a grade item, e.g. "0–10".
+type GradeRange struct {
+	Min, Max float64
+	Valid    bool
+}
+
+var numberPattern = regexp.MustCompile(`^-?(\d+\.?\d*|\.\d+)$`)
+
+var rangePattern = regexp.MustCompile(`^(-?[\d.,]+)\s*[–—-]\s*(-?[\d.,]+)$`)
+
+// ParseGradeRange parses a range cell; Valid is false when it isn't one.
+func ParseGradeRange(s string) GradeRange {
+	text := strings.TrimSpace(strings.Map(normalizeSpace, s))
+	m := rangePattern.FindStringSubmatch(text)
+	if m == nil {
+		return GradeRange{}
+	}
+	lo, ok1 := parseNumber(m[1])
+	hi, ok2 := parseNumber(m[2])
+	if !ok1 || !ok2 || hi < lo {
+		return GradeRange{}
+	}
+	return GradeRange{Min: lo, Max: hi, Valid: true}
+}
+
+func (r GradeRange) String() string {
+	if !r.Valid {
+		return ""
+	}
+	return FormatNumber(r.Min) + "–" + FormatNumber(r.Max)
+}
+
+// FormatNumber formats a grade without trailing zeros and at most two
+// decimals, e.g. 8, 9.5 or 66.67.
+func FormatNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// normalizeSpace turns the non-breaking spaces some locales put in numbers
+// like "1 234,5" into plain ones.
+func normalizeSpace(r rune) rune {
+	switch r {
+	case '\u00a0', '\u202f', '\t':
+		return ' '
+	}
+	return r
+}
+
+// parseNumber reads a number with either decimal separator. When both
+// appear, the last one is the decimal separator and the other groups
+// thousands: "1,234.5" and "1.234,5" are both 1234.5.
+func parseNumber(s string) (float64, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "")
+	if s == "" {
+		return 0, false
+	}
+
+	dot, comma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case dot >= 0 && comma >= 0 && comma > dot:
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.Replace(s, ",", ".", 1)
+	case dot >= 0 && comma >= 0:
+		s = strings.ReplaceAll(s, ",", "")
+	case comma >= 0:
+		if strings.Count(s, ",") > 1 {
+			s = strings.ReplaceAll(s, ",", "")
+		} else {
+			s = strings.Replace(s, ",", ".", 1)
+		}
+	}
+
+	if !numberPattern.MatchString(s) {
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	return v, true
+}
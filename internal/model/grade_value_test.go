@@ -0,0 +1,63 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGradeValue(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected GradeValue
+	}{
+		{input: "8.00", expected: GradeValue{Value: 8, State: Graded, Text: "8.00"}},
+		{input: " 9,50 ", expected: GradeValue{Value: 9.5, State: Graded, Text: "9,50"}},
+		{input: "80.00 %", expected: GradeValue{Value: 80, State: Graded, Text: "80.00 %"}},
+		{input: "66,67 %", expected: GradeValue{Value: 66.67, State: Graded, Text: "66,67 %"}},
+		{input: "1,234.5", expected: GradeValue{Value: 1234.5, State: Graded, Text: "1,234.5"}},
+		{input: "1.234,5", expected: GradeValue{Value: 1234.5, State: Graded, Text: "1.234,5"}},
+		{input: "-2.5", expected: GradeValue{Value: -2.5, State: Graded, Text: "-2.5"}},
+		{input: "-", expected: GradeValue{State: NotGraded, Text: "-"}},
+		{input: "", expected: GradeValue{State: NotGraded}},
+		{input: "Not graded", expected: GradeValue{State: NotGraded, Text: "Not graded"}},
+		{input: "A-", expected: GradeValue{State: Unparsed, Text: "A-"}},
+		{input: "Inf", expected: GradeValue{State: Unparsed, Text: "Inf"}},
+		{input: "1.2.3", expected: GradeValue{State: Unparsed, Text: "1.2.3"}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ParseGradeValue(tc.input))
+		})
+	}
+}
+
+func TestParseGradeRange(t *testing.T) {
+	testcases := []struct {
+		input    string
+		expected GradeRange
+	}{
+		{input: "0–10", expected: GradeRange{Min: 0, Max: 10, Valid: true}},
+		{input: "0.00–100.00", expected: GradeRange{Min: 0, Max: 100, Valid: true}},
+		{input: "0,00 - 12,50", expected: GradeRange{Min: 0, Max: 12.5, Valid: true}},
+		{input: "1—5", expected: GradeRange{Min: 1, Max: 5, Valid: true}},
+		{input: "10–0", expected: GradeRange{}},
+		{input: "-", expected: GradeRange{}},
+		{input: "F–A", expected: GradeRange{}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ParseGradeRange(tc.input))
+		})
+	}
+}
+
+func TestGradeValue_String(t *testing.T) {
+	assert.Equal(t, "8", ParseGradeValue("8.00").String())
+	assert.Equal(t, "66.67", ParseGradeValue("66,666").String())
+	assert.Equal(t, "-", ParseGradeValue("").String())
+	assert.Equal(t, "Pass", ParseGradeValue("Pass").String())
+	assert.Equal(t, "0–12.5", ParseGradeRange("0,00–12,50").String())
+}
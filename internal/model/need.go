@@ -0,0 +1,61 @@
+package model
+
+import "math"
+
+// Requirement is what the ungraded items of a course need for the course
+// total to reach a target.
+type Requirement struct {
+	Target float64
+	// Needed is the average, in percent, the ungraded items need.
+	Needed float64
+	// Remaining is the share of the course weight not graded yet, in percent.
+	Remaining float64
+	// Min and Max are the course totals with 0% and 100% on the rest.
+	Min, Max float64
+	Standing Standing
+}
+
+// Impossible reports whether even full marks on the rest miss the target.
+func (r Requirement) Impossible() bool {
+	return r.Needed > 100
+}
+
+// Secured reports whether the target is reached whatever the rest scores.
+func (r Requirement) Secured() bool {
+	return r.Needed <= 0
+}
+
+// Need computes the average the ungraded items need for the course total to
+// reach target percent, using the same weights as ComputeStanding. It is
+// false when the report has neither weights nor ranges.
+func Need(rows []*GradeRow, target float64) (Requirement, bool) {
+	weights := effectiveWeights(rows)
+	if len(weights) == 0 {
+		return Requirement{}, false
+	}
+
+	standing, _ := ComputeStanding(rows)
+	req := Requirement{Target: target, Standing: standing}
+	for row, w := range weights {
+		if row.ScoreValue.State == NotGraded {
+			req.Remaining += w * 100
+		}
+	}
+
+	total := standing.Graded + req.Remaining
+	if total == 0 {
+		return Requirement{}, false
+	}
+	req.Min = standing.Earned / total * 100
+	req.Max = (standing.Earned + req.Remaining) / total * 100
+
+	if req.Remaining == 0 {
+		// Nothing left to grade: the target is either reached or not.
+		if standing.Current < target {
+			req.Needed = math.Inf(1)
+		}
+		return req, true
+	}
+	req.Needed = (target*total/100 - standing.Earned) / req.Remaining * 100
+	return req, true
+}
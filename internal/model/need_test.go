@@ -0,0 +1,68 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNeed(t *testing.T) {
+	rows := []*GradeRow{
+		row("Calculus II", ItemRow, "Quiz 1", "20.00 %", "8.00", "0–10"),
+		row("Calculus II", ItemRow, "Midterm", "30.00 %", "60.00", "0–100"),
+		row("Calculus II", ItemRow, "Final", "50.00 %", "-", "0–100"),
+	}
+
+	testcases := []struct {
+		name       string
+		rows       []*GradeRow
+		target     float64
+		needed     float64
+		secured    bool
+		impossible bool
+	}{
+		// 34% earned, 50% left: (70 - 34) / 50
+		{name: "reachable", rows: rows, target: 70, needed: 72},
+		{name: "secured", rows: rows, target: 30, needed: -8, secured: true},
+		{name: "impossible", rows: rows, target: 90, needed: 112, impossible: true},
+		{
+			name:   "all graded",
+			rows:   rows[:2],
+			target: 70,
+			needed: math.Inf(1), impossible: true,
+		},
+		{
+			name: "natural aggregation",
+			rows: []*GradeRow{
+				row("Calculus II", ItemRow, "Quiz 1", "", "5.00", "0–10"),
+				row("Calculus II", ItemRow, "Final", "", "-", "0–30"),
+			},
+			target: 50,
+			// (0.5 * 40 - 5) / 30
+			needed: 50,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, ok := Need(tc.rows, tc.target)
+			assert.True(t, ok)
+			if math.IsInf(tc.needed, 1) {
+				assert.True(t, math.IsInf(req.Needed, 1))
+			} else {
+				assert.InDelta(t, tc.needed, req.Needed, 1e-9)
+			}
+			assert.Equal(t, tc.secured, req.Secured())
+			assert.Equal(t, tc.impossible, req.Impossible())
+		})
+	}
+
+	req, _ := Need(rows, 70)
+	assert.InDelta(t, 50, req.Remaining, 1e-9)
+	assert.InDelta(t, 34, req.Min, 1e-9)
+	assert.InDelta(t, 84, req.Max, 1e-9)
+
+	_, ok := Need([]*GradeRow{row("Calculus II", ItemRow, "Essay", "", "A", "")}, 70)
+	assert.False(t, ok)
+}
@@ -0,0 +1,118 @@
+package model
+
+import "strings"
+
+// Standing is where a student stands in a course, from the items graded so
+// far.
+type Standing struct {
+	// Current is the weighted average of the graded items, in percent.
+	Current float64
+	// Earned is what the graded items add to the course total, in percent
+	// of the whole course.
+	Earned float64
+	// Graded is the share of the course weight already graded, in percent.
+	Graded float64
+	// Reported is the course total Moodle shows, in percent, if the report
+	// has one.
+	Reported GradeValue
+}
+
+// ComputeStanding weighs every graded item by its calculated weight, scaled
+// by the weights of the categories it is nested in. When the report has no
+// weight column, items are weighed by their range, like Moodle's natural
+// aggregation does. It is false when nothing is graded yet.
+func ComputeStanding(rows []*GradeRow) (Standing, bool) {
+	weights := effectiveWeights(rows)
+
+	var st Standing
+	for _, row := range rows {
+		if row.Kind == CourseTotalRow {
+			st.Reported = row.PercentValue
+			if !st.Reported.IsGraded() {
+				if f, ok := row.Fraction(); ok {
+					st.Reported = GradeValue{Value: f * 100, State: Graded}
+				}
+			}
+			continue
+		}
+
+		w, ok := weights[row]
+		if !ok {
+			continue
+		}
+		f, ok := row.Fraction()
+		if !ok {
+			continue
+		}
+		st.Earned += w * f * 100
+		st.Graded += w * 100
+	}
+
+	if st.Graded > 0 {
+		st.Current = st.Earned / st.Graded * 100
+	}
+	return st, st.Graded > 0 || st.Reported.IsGraded()
+}
+
+// effectiveWeights returns the share of the course total of every item that
+// has a weight.
+func effectiveWeights(rows []*GradeRow) map[*GradeRow]float64 {
+	out := map[*GradeRow]float64{}
+
+	weighted := false
+	for _, row := range rows {
+		if !row.IsTotal() && row.WeightValue.IsGraded() {
+			weighted = true
+			break
+		}
+	}
+
+	if !weighted {
+		var total float64
+		for _, row := range rows {
+			if !row.IsTotal() && row.RangeValue.Valid {
+				total += row.RangeValue.Max - row.RangeValue.Min
+			}
+		}
+		if total == 0 {
+			return out
+		}
+		for _, row := range rows {
+			if !row.IsTotal() && row.RangeValue.Valid {
+				out[row] = (row.RangeValue.Max - row.RangeValue.Min) / total
+			}
+		}
+		return out
+	}
+
+	// The weight of a category total is the weight of the category in its
+	// parent.
+	categoryWeights := map[string]float64{}
+	for _, row := range rows {
+		if row.Kind == CategoryTotalRow && row.WeightValue.IsGraded() {
+			categoryWeights[row.Category] = row.WeightValue.Value / 100
+		}
+	}
+
+	for _, row := range rows {
+		if row.IsTotal() || !row.WeightValue.IsGraded() {
+			continue
+		}
+		w := row.WeightValue.Value / 100
+		for path := row.Category; path != ""; path = parentCategory(path) {
+			if cw, ok := categoryWeights[path]; ok {
+				w *= cw
+			}
+		}
+		out[row] = w
+	}
+	return out
+}
+
+func parentCategory(path string) string {
+	i := strings.LastIndex(path, CategorySeparator)
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
@@ -0,0 +1,85 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func row(category string, kind RowKind, cols ...string) *GradeRow {
+	raw := make([]string, NumColumns)
+	copy(raw, cols)
+	raw[ColKind] = string(kind)
+	raw[ColCategory] = category
+	return NewGradeRow(raw)
+}
+
+func TestComputeStanding(t *testing.T) {
+	testcases := []struct {
+		name     string
+		rows     []*GradeRow
+		expected Standing
+		ok       bool
+	}{
+		{
+			name: "flat weights",
+			rows: []*GradeRow{
+				row("Calculus II", ItemRow, "Quiz 1", "20.00 %", "8.00", "0–10"),
+				row("Calculus II", ItemRow, "Midterm", "30.00 %", "60.00", "0–100"),
+				row("Calculus II", ItemRow, "Final", "50.00 %", "-", "0–100"),
+			},
+			// (0.2*0.8 + 0.3*0.6) / 0.5
+			expected: Standing{Current: 68, Earned: 34, Graded: 50},
+			ok:       true,
+		},
+		{
+			name: "nested categories",
+			rows: []*GradeRow{
+				row("Calculus II", ItemRow, "Midterm", "60.00 %", "70.00", "0–100"),
+				row("Calculus II / Homework", ItemRow, "HW 1", "50.00 %", "9.00", "0–10"),
+				row("Calculus II / Homework", ItemRow, "HW 2", "50,00 %", "-", "0–10"),
+				row("Calculus II / Homework", CategoryTotalRow, "Homework total", "40.00 %", "9.00", "0–10"),
+				row("Calculus II", CourseTotalRow, "Course total", "-", "78.00", "0–100", "78.00 %"),
+			},
+			// HW 1 is 50% of a category worth 40%: 0.6*0.7 + 0.2*0.9 = 0.6 of 0.8 graded.
+			expected: Standing{Current: 75, Earned: 60, Graded: 80, Reported: ParseGradeValue("78.00 %")},
+			ok:       true,
+		},
+		{
+			name: "natural aggregation without weights",
+			rows: []*GradeRow{
+				row("Calculus II", ItemRow, "Quiz 1", "", "5.00", "0–10"),
+				row("Calculus II", ItemRow, "Quiz 2", "", "-", "0–30"),
+			},
+			expected: Standing{Current: 50, Earned: 12.5, Graded: 25},
+			ok:       true,
+		},
+		{
+			name: "only the course total",
+			rows: []*GradeRow{
+				row("Calculus II", ItemRow, "Quiz 1", "", "-", ""),
+				row("Calculus II", CourseTotalRow, "Course total", "", "45.00", "0–60"),
+			},
+			expected: Standing{Reported: GradeValue{Value: 75, State: Graded}},
+			ok:       true,
+		},
+		{
+			name: "nothing graded",
+			rows: []*GradeRow{
+				row("Calculus II", ItemRow, "Quiz 1", "10.00 %", "-", "0–10"),
+			},
+			ok: false,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			st, ok := ComputeStanding(tc.rows)
+			assert.Equal(t, tc.ok, ok)
+			assert.InDelta(t, tc.expected.Current, st.Current, 1e-9)
+			assert.InDelta(t, tc.expected.Earned, st.Earned, 1e-9)
+			assert.InDelta(t, tc.expected.Graded, st.Graded, 1e-9)
+			assert.Equal(t, tc.expected.Reported, st.Reported)
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package model
+
+import "slices"
+
+// WithFraction returns a copy of the row scored at the given share of its
+// range, e.g. 0.9 for 9 out of 0–10. The row must have a valid range.
+func (gr *GradeRow) WithFraction(f float64) *GradeRow {
+	r := gr.RangeValue
+	raw := slices.Clone(gr.Raw)
+	raw[ColScore] = FormatNumber(r.Min + f*(r.Max-r.Min))
+	raw[ColPercentage] = FormatNumber(f*100) + " %"
+	return NewGradeRow(raw)
+}
+
+// WhatIf returns the rows of a course with hypothetical scores, given as a
+// share of the range of each item. The course total is left out since
+// Moodle's figure no longer applies. The rows passed in are not modified.
+func WhatIf(rows []*GradeRow, fractions map[*GradeRow]float64) []*GradeRow {
+	out := make([]*GradeRow, 0, len(rows))
+	for _, row := range rows {
+		if row.Kind == CourseTotalRow {
+			continue
+		}
+		if f, ok := fractions[row]; ok {
+			row = row.WithFraction(f)
+		}
+		out = append(out, row)
+	}
+	return out
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWhatIf(t *testing.T) {
+	quiz := row("Calculus II", ItemRow, "Quiz 1", "20.00 %", "8.00", "0–10", "80.00 %")
+	final := row("Calculus II", ItemRow, "Final", "80.00 %", "-", "0–100", "-")
+	total := row("Calculus II", CourseTotalRow, "Course total", "", "1.60", "0–100", "1.60 %")
+	rows := []*GradeRow{quiz, final, total}
+
+	simulated := WhatIf(rows, map[*GradeRow]float64{final: 0.75})
+	require.Len(t, simulated, 2)
+	assert.Same(t, quiz, simulated[0])
+	assert.Equal(t, "Final 75% (75/100)", simulated[1].StringWithName())
+	assert.Equal(t, "-", final.Score, "stored rows are not modified")
+
+	st, ok := ComputeStanding(simulated)
+	require.True(t, ok)
+	assert.InDelta(t, 76, st.Current, 1e-9)
+	assert.InDelta(t, 100, st.Graded, 1e-9)
+	assert.False(t, st.Reported.IsGraded())
+}
+
+func TestGradeRow_WithFraction(t *testing.T) {
+	lab := NewGradeRow([]string{"Lab", "", "-", "10–20", "-", "Late"})
+
+	got := lab.WithFraction(0.5)
+	assert.Equal(t, "15", got.Score)
+	assert.Equal(t, "50 %", got.Percentage)
+	assert.Equal(t, "Late", got.Feedback)
+	f, ok := got.Fraction()
+	assert.True(t, ok)
+	assert.InDelta(t, 0.5, f, 1e-9)
+}
@@ -0,0 +1,69 @@
+package moodletest
+
+import "html/template"
+
+// The templates follow the markup of Moodle 4.x with the default theme,
+// reduced to the parts the scraper reads.
+
+var loginTmpl = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><body>
+{{if .}}<div class="alert alert-danger" role="alert">{{.}}</div>{{end}}
+<form class="login-form" action="/login/index.php" method="post" id="login">
+	<input type="hidden" name="anchor" value="">
+	<input type="hidden" name="logintoken" value="fake-login-token">
+	<input type="text" name="username" id="username" value="">
+	<input type="password" name="password" id="password" value="">
+	<button type="submit" id="loginbtn">Log in</button>
+</form>
+</body></html>`))
+
+var mainTmpl = template.Must(template.New("main").Parse(`<!DOCTYPE html>
+<html><body>
+<div class="page-header-headings"><h1>Dashboard</h1></div>
+<a class="dropdown-item" href="/login/logout.php?sesskey=fake">Log out</a>
+</body></html>`))
+
+var maintenanceTmpl = template.Must(template.New("maintenance").Parse(`<!DOCTYPE html>
+<html><body>
+<div class="box py-3 generalbox"><h2>Site is undergoing maintenance and is currently not available</h2></div>
+</body></html>`))
+
+var overviewTmpl = template.Must(template.New("overview").Parse(`<!DOCTYPE html>
+<html><body>
+<table id="overview-grade" class="generaltable">
+<thead><tr><th class="header c0">Course name</th><th class="header c1">Grade</th></tr></thead>
+<tbody>
+{{range .}}<tr><td class="cell c0"><a href="{{.URL}}">{{.Name}}</a></td><td class="cell c1">-</td></tr>
+{{end}}<tr class="emptyrow"><td class="cell c0"></td><td class="cell c1"></td></tr>
+</tbody>
+</table>
+</body></html>`))
+
+var courseTmpl = template.Must(template.New("course").Parse(`<!DOCTYPE html>
+<html><body>
+<div class="page-header-headings"><h1>{{.Name}}</h1></div>
+<table class="generaltable user-grade">
+<thead><tr>
+	<th class="header column-itemname" colspan="2">Grade item</th>
+	<th class="header column-weight">Calculated weight</th>
+	<th class="header column-grade">Grade</th>
+	<th class="header column-range">Range</th>
+	<th class="header column-percentage">Percentage</th>
+	<th class="header column-feedback">Feedback</th>
+	<th class="header column-contributiontocoursetotal">Contribution to course total</th>
+</tr></thead>
+<tbody>
+<tr><th class="category column-itemname" colspan="8"><div class="rowtitle"><span>{{.Name}}</span></div></th></tr>
+{{range .Items}}<tr>
+	<td class="spacer b1t b1b b1l"></td>
+	<th class="item column-itemname"><div class="rowtitle"><a href="#">{{.Name}}</a></div></th>
+	<td class="column-weight">{{.Weight}}</td>
+	<td class="column-grade">{{.Grade}}</td>
+	<td class="column-range">{{.Range}}</td>
+	<td class="column-percentage">{{.Percentage}}</td>
+	<td class="column-feedback">{{.Feedback}}</td>
+	<td class="column-contributiontocoursetotal">-</td>
+</tr>
+{{end}}</tbody>
+</table>
+</body></html>`))
@@ -0,0 +1,292 @@
+// Package moodletest is a fake Moodle site for tests. It serves the login
+// form, the grades overview and the user grade report of every course, and
+// lets tests expire sessions, change the password and edit grades.
+package moodletest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+)
+
+const (
+	LoginPath    = "/login/index.php"
+	MainPath     = "/my/"
+	OverviewPath = "/grade/report/overview/index.php"
+	CoursePath   = "/course/user.php"
+
+	sessionCookie = "MoodleSession"
+)
+
+// Item is a row of the user grade report.
+type Item struct {
+	Name       string
+	Weight     string
+	Grade      string
+	Range      string
+	Percentage string
+	Feedback   string
+}
+
+type Course struct {
+	ID    int
+	Name  string
+	Items []Item
+}
+
+type Server struct {
+	*httptest.Server
+
+	mux      sync.Mutex
+	user     string
+	pass     string
+	courses  []*Course
+	sessions map[string]bool
+	logins   int
+	// maintenance answers logins with the maintenance page.
+	maintenance bool
+}
+
+// New starts a server accepting the given credentials. It is closed when the
+// test finishes.
+func New(t testing.TB, user, pass string, courses ...Course) *Server {
+	s := &Server{
+		user:     user,
+		pass:     pass,
+		sessions: map[string]bool{},
+	}
+	for _, c := range courses {
+		s.AddCourse(c)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+LoginPath, s.handleLoginForm)
+	mux.HandleFunc("POST "+LoginPath, s.handleLogin)
+	mux.HandleFunc("GET "+MainPath, s.requireSession(s.handleMain))
+	mux.HandleFunc("GET "+OverviewPath, s.requireSession(s.handleOverview))
+	mux.HandleFunc("GET "+CoursePath, s.requireSession(s.handleCourse))
+
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// MoodleConfig returns a scraper config for this server with the accepted
+// credentials and no retries.
+func (s *Server) MoodleConfig() config.MoodleConfig {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return config.MoodleConfig{
+		MoodleSource:           config.MoodleSourceScrape,
+		MoodleMainPage:         s.URL + MainPath,
+		MoodleLoginPage:        s.URL + LoginPath,
+		MoodleGradePage:        s.URL + OverviewPath,
+		MoodleUser:             s.user,
+		MoodlePass:             s.pass,
+		MoodleRetryMaxAttempts: 1,
+		MoodleRequestTimeout:   5 * time.Second,
+	}
+}
+
+// Logins returns how many successful form logins the server has seen.
+func (s *Server) Logins() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.logins
+}
+
+// ExpireSessions logs every client out, as Moodle does after a session timeout.
+func (s *Server) ExpireSessions() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	clear(s.sessions)
+}
+
+// SetPassword changes the accepted password, so clients holding the old one
+// get "Invalid login".
+func (s *Server) SetPassword(pass string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.pass = pass
+}
+
+// SetMaintenance puts the site in maintenance mode: logins get a cookie and
+// the maintenance page, neither logged in nor rejected.
+func (s *Server) SetMaintenance(on bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.maintenance = on
+}
+
+func (s *Server) AddCourse(c Course) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	c.Items = slices.Clone(c.Items)
+	s.courses = append(s.courses, &c)
+}
+
+// RenameCourse changes the display name of a course; its ID stays.
+func (s *Server) RenameCourse(courseID int, name string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.course(courseID).Name = name
+}
+
+// SetItem replaces the item with the same name or appends it.
+func (s *Server) SetItem(courseID int, item Item) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	c := s.course(courseID)
+	idx := slices.IndexFunc(c.Items, func(it Item) bool { return it.Name == item.Name })
+	if idx < 0 {
+		c.Items = append(c.Items, item)
+		return
+	}
+	c.Items[idx] = item
+}
+
+func (s *Server) RemoveItem(courseID int, name string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	c := s.course(courseID)
+	c.Items = slices.DeleteFunc(c.Items, func(it Item) bool { return it.Name == name })
+}
+
+func (s *Server) course(id int) *Course {
+	idx := slices.IndexFunc(s.courses, func(c *Course) bool { return c.ID == id })
+	if idx < 0 {
+		panic(fmt.Sprintf("moodletest: no course %d", id))
+	}
+	return s.courses[idx]
+}
+
+// requireSession redirects to the login page without a valid session, the
+// way Moodle does.
+func (s *Server) requireSession(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.hasSession(r) {
+			http.Redirect(w, r, LoginPath, http.StatusSeeOther)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) hasSession(r *http.Request) bool {
+	cookie, err := r.Cookie(sessionCookie)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return err == nil && s.sessions[cookie.Value]
+}
+
+// handleLoginForm sends clients that are logged in already to the dashboard,
+// the way Moodle does.
+func (s *Server) handleLoginForm(w http.ResponseWriter, r *http.Request) {
+	if s.hasSession(r) {
+		http.Redirect(w, r, MainPath, http.StatusSeeOther)
+		return
+	}
+	render(w, loginTmpl, nil)
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mux.Lock()
+	if s.maintenance {
+		s.mux.Unlock()
+		http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: newSessionID(), Path: "/"})
+		render(w, maintenanceTmpl, nil)
+		return
+	}
+	if r.PostForm.Get("logintoken") == "" ||
+		r.PostForm.Get("username") != s.user || r.PostForm.Get("password") != s.pass {
+		s.mux.Unlock()
+		render(w, loginTmpl, "Invalid login, please try again")
+		return
+	}
+
+	id := newSessionID()
+	s.sessions[id] = true
+	s.logins++
+	s.mux.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Value: id, Path: "/"})
+	http.Redirect(w, r, MainPath, http.StatusSeeOther)
+}
+
+func (s *Server) handleMain(w http.ResponseWriter, r *http.Request) {
+	render(w, mainTmpl, nil)
+}
+
+func (s *Server) handleOverview(w http.ResponseWriter, r *http.Request) {
+	type link struct {
+		Name string
+		URL  string
+	}
+
+	s.mux.Lock()
+	var links []link
+	for _, c := range s.courses {
+		links = append(links, link{
+			Name: c.Name,
+			URL:  fmt.Sprintf("%s%s?mode=grade&id=%d&user=2", s.URL, CoursePath, c.ID),
+		})
+	}
+	s.mux.Unlock()
+
+	render(w, overviewTmpl, links)
+}
+
+func (s *Server) handleCourse(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "invalid course id", http.StatusBadRequest)
+		return
+	}
+
+	s.mux.Lock()
+	idx := slices.IndexFunc(s.courses, func(c *Course) bool { return c.ID == id })
+	var c Course
+	if idx >= 0 {
+		c = *s.courses[idx]
+		c.Items = slices.Clone(c.Items)
+	}
+	s.mux.Unlock()
+
+	if idx < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	render(w, courseTmpl, c)
+}
+
+func newSessionID() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func render(w http.ResponseWriter, tmpl *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := tmpl.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,77 @@
+package notify
+
+import (
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+)
+
+// chatMessageLimit is Discord's message limit in characters, Slack allows
+// more.
+const chatMessageLimit = 2000
+
+// slackEscaper escapes the characters Slack reads as markup in "text".
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// ChatWebhook posts to a Discord or Slack incoming webhook. Both accept the
+// same payload: Discord reads "content", Slack reads "text".
+type ChatWebhook struct {
+	client *http.Client
+	url    string
+}
+
+func NewChatWebhook(url string) *ChatWebhook {
+	return &ChatWebhook{
+		client: &http.Client{Timeout: 30 * time.Second},
+		url:    url,
+	}
+}
+
+type chatWebhookPayload struct {
+	Content string `json:"content"`
+	Text    string `json:"text"`
+}
+
+func (w *ChatWebhook) Notify(changes []model.Change) error {
+	var messages []string
+	var sb strings.Builder
+	size := 0
+	for _, ch := range changes {
+		s := truncate(ch.ToPlainString(), chatMessageLimit)
+		n := utf8.RuneCountInString(s)
+		if size > 0 && size+n+2 > chatMessageLimit {
+			messages = append(messages, sb.String())
+			sb.Reset()
+			size = 0
+		}
+		if size > 0 {
+			sb.WriteString("\n\n")
+			size += 2
+		}
+		sb.WriteString(s)
+		size += n
+	}
+	if size > 0 {
+		messages = append(messages, sb.String())
+	}
+
+	for _, msg := range messages {
+		err := postJSON(w.client, w.url, chatWebhookPayload{Content: msg, Text: slackEscaper.Replace(msg)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate cuts s to at most limit characters, marking the cut with "…".
+func truncate(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
@@ -0,0 +1,62 @@
+package notify
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+)
+
+// Email sends one HTML email per sync through an SMTP server.
+type Email struct {
+	addr string
+	auth smtp.Auth
+	from string
+	to   []string
+}
+
+func NewEmail(cfg config.NotifyConfig) *Email {
+	var auth smtp.Auth
+	if cfg.SMTPUser != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUser, cfg.SMTPPass, cfg.SMTPHost)
+	}
+
+	return &Email{
+		addr: net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+		auth: auth,
+		from: cfg.SMTPFrom,
+		to:   cfg.SMTPTo,
+	}
+}
+
+func (e *Email) Notify(changes []model.Change) error {
+	var body strings.Builder
+	for _, ch := range changes {
+		// Telegram HTML is close enough to email HTML, only newlines differ.
+		body.WriteString("<p>")
+		body.WriteString(strings.ReplaceAll(ch.ToHTMLString(), "\n", "<br>"))
+		body.WriteString("</p>\n")
+	}
+
+	subject := fmt.Sprintf("Moodle grades: %d change(s)", len(changes))
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	msg.WriteString(body.String())
+
+	err := smtp.SendMail(e.addr, e.auth, e.from, e.to, []byte(msg.String()))
+	if err != nil {
+		return fmt.Errorf("error sending email: %v", err)
+	}
+	return nil
+}
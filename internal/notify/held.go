@@ -0,0 +1,109 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+)
+
+// HeldStore persists the changes QuietHours holds back, by chat, so a
+// restart inside the window does not lose them.
+type HeldStore struct {
+	path string
+
+	mux  sync.Mutex
+	held map[string][]heldChange
+}
+
+type heldChange struct {
+	Type       model.ChangeType `json:"type"`
+	CourseID   string           `json:"course_id"`
+	CourseName string           `json:"course_name"`
+	Old        []string         `json:"old,omitempty"`
+	New        []string         `json:"new,omitempty"`
+	Standing   *model.Standing  `json:"standing,omitempty"`
+}
+
+// NewHeldStore loads the changes held in path; an empty path keeps them in
+// memory only.
+func NewHeldStore(path string) (*HeldStore, error) {
+	s := &HeldStore{path: path, held: map[string][]heldChange{}}
+	if path == "" {
+		return s, nil
+	}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read held changes: %v", err)
+	}
+	if err := json.Unmarshal(buf, &s.held); err != nil {
+		return nil, fmt.Errorf("failed to parse held changes: %v", err)
+	}
+	return s, nil
+}
+
+// Load returns the changes held for key.
+func (s *HeldStore) Load(key string) []model.Change {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var changes []model.Change
+	for _, h := range s.held[key] {
+		ch := model.Change{TP: h.Type, CourseID: h.CourseID, CourseName: h.CourseName, Standing: h.Standing}
+		if len(h.Old) > 0 {
+			ch.Old = model.NewGradeRow(h.Old)
+		}
+		if len(h.New) > 0 {
+			ch.New = model.NewGradeRow(h.New)
+		}
+		changes = append(changes, ch)
+	}
+	return changes
+}
+
+// Save replaces the changes held for key; no changes removes it.
+func (s *HeldStore) Save(key string, changes []model.Change) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if len(changes) == 0 {
+		delete(s.held, key)
+	} else {
+		held := make([]heldChange, 0, len(changes))
+		for _, ch := range changes {
+			h := heldChange{Type: ch.TP, CourseID: ch.CourseID, CourseName: ch.CourseName, Standing: ch.Standing}
+			if ch.Old != nil {
+				h.Old = ch.Old.ToStringSlice()
+			}
+			if ch.New != nil {
+				h.New = ch.New.ToStringSlice()
+			}
+			held = append(held, h)
+		}
+		s.held[key] = held
+	}
+
+	if s.path == "" {
+		return nil
+	}
+	buf, err := json.Marshal(s.held)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -0,0 +1,60 @@
+package notify
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+)
+
+// Notifier delivers the changes found by a sync.
+type Notifier interface {
+	Notify(changes []model.Change) error
+}
+
+// Fanout delivers to every notifier, even if some of them fail.
+type Fanout []Notifier
+
+func (f Fanout) Notify(changes []model.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+
+	var errs []error
+	for _, n := range f {
+		if err := n.Notify(changes); err != nil {
+			slog.Error("Notifier failed", "notifier", describe(n), "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// FromConfig builds the additional delivery channels enabled in the config.
+func FromConfig(cfg config.NotifyConfig) Fanout {
+	var f Fanout
+	if cfg.WebhookURL != "" {
+		f = append(f, NewWebhook(cfg.WebhookURL))
+	}
+	if cfg.ChatWebhookURL != "" {
+		f = append(f, NewChatWebhook(cfg.ChatWebhookURL))
+	}
+	if cfg.SMTPHost != "" {
+		f = append(f, NewEmail(cfg))
+	}
+	return f
+}
+
+func describe(n Notifier) string {
+	switch n.(type) {
+	case *Webhook:
+		return "webhook"
+	case *ChatWebhook:
+		return "chat_webhook"
+	case *Email:
+		return "email"
+	default:
+		return "other"
+	}
+}
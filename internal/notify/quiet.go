@@ -0,0 +1,171 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+)
+
+// BatchNotifier is implemented by notifiers that can deliver many changes as
+// a single message.
+type BatchNotifier interface {
+	NotifyBatch(changes []model.Change) error
+}
+
+// NotifyBatch delivers the changes as one message where the notifier
+// supports it and falls back to Notify otherwise.
+func NotifyBatch(n Notifier, changes []model.Change) error {
+	if b, ok := n.(BatchNotifier); ok {
+		return b.NotifyBatch(changes)
+	}
+	return n.Notify(changes)
+}
+
+func (f Fanout) NotifyBatch(changes []model.Change) error {
+	var errs []error
+	for _, n := range f {
+		if err := NotifyBatch(n, changes); err != nil {
+			slog.Error("Notifier failed", "notifier", describe(n), "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Window is a daily time range in local time, e.g. 23:00-08:00. It may wrap
+// around midnight.
+type Window struct {
+	start, end time.Duration
+}
+
+// ParseWindow parses "HH:MM-HH:MM". An empty string is a zero window that
+// never contains anything.
+func ParseWindow(s string) (Window, error) {
+	if s == "" {
+		return Window{}, nil
+	}
+
+	var sh, sm, eh, em int
+	_, err := fmt.Sscanf(s, "%d:%d-%d:%d", &sh, &sm, &eh, &em)
+	if err != nil || sh > 23 || eh > 23 || sm > 59 || em > 59 || sh < 0 || eh < 0 || sm < 0 || em < 0 {
+		return Window{}, fmt.Errorf("invalid time window %q, want HH:MM-HH:MM", s)
+	}
+
+	return Window{
+		start: time.Duration(sh)*time.Hour + time.Duration(sm)*time.Minute,
+		end:   time.Duration(eh)*time.Hour + time.Duration(em)*time.Minute,
+	}, nil
+}
+
+func (w Window) IsZero() bool {
+	return w.start == w.end
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+func (w Window) Contains(t time.Time) bool {
+	if w.IsZero() {
+		return false
+	}
+	d := sinceMidnight(t)
+	if w.start < w.end {
+		return d >= w.start && d < w.end
+	}
+	return d >= w.start || d < w.end
+}
+
+// End returns the end of the window that contains t.
+func (w Window) End(t time.Time) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	end := midnight.Add(w.end)
+	if !end.After(t) {
+		end = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Add(w.end)
+	}
+	return end
+}
+
+// QuietHours holds back changes found inside the window and delivers them as
+// one batch when the window ends. Held changes are saved in a HeldStore and
+// picked up again after a restart.
+type QuietHours struct {
+	inner  Notifier
+	window Window
+	store  *HeldStore
+	key    string
+
+	mux     sync.Mutex
+	pending []model.Change
+	timer   *time.Timer
+}
+
+// NewQuietHours restores the changes held for key in store. Changes held
+// across the end of the window are delivered right away.
+func NewQuietHours(inner Notifier, window Window, store *HeldStore, key string) *QuietHours {
+	q := &QuietHours{
+		inner:   inner,
+		window:  window,
+		store:   store,
+		key:     key,
+		pending: store.Load(key),
+	}
+	if len(q.pending) > 0 {
+		now := time.Now()
+		wait := time.Duration(0)
+		if window.Contains(now) {
+			wait = time.Until(window.End(now))
+		}
+		slog.Info("Restored held changes", "key", key, "count", len(q.pending), "in", wait)
+		q.mux.Lock()
+		q.timer = time.AfterFunc(wait, q.flush)
+		q.mux.Unlock()
+	}
+	return q
+}
+
+func (q *QuietHours) Notify(changes []model.Change) error {
+	now := time.Now()
+	if !q.window.Contains(now) {
+		return q.inner.Notify(changes)
+	}
+
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	q.pending = append(q.pending, changes...)
+	if q.timer == nil {
+		end := q.window.End(now)
+		slog.Debug("Quiet hours, holding changes", "count", len(changes), "until", end)
+		q.timer = time.AfterFunc(time.Until(end), q.flush)
+	}
+	return q.store.Save(q.key, q.pending)
+}
+
+func (q *QuietHours) flush() {
+	q.mux.Lock()
+	pending := q.pending
+	q.pending = nil
+	q.timer = nil
+	q.mux.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+
+	slog.Info("Quiet hours over, delivering held changes", "count", len(pending))
+	if err := NotifyBatch(q.inner, pending); err != nil {
+		slog.Error("Failed to deliver held changes", "error", err)
+	}
+
+	// Changes held while delivering stay in the store.
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	if err := q.store.Save(q.key, q.pending); err != nil {
+		slog.Error("Failed to save held changes", "error", err)
+	}
+}
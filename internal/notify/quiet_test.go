@@ -0,0 +1,103 @@
+package notify
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWindow(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2025, 3, day, hour, min, 0, 0, time.UTC)
+	}
+
+	overnight, err := ParseWindow("23:00-08:00")
+	require.NoError(t, err)
+	assert.True(t, overnight.Contains(at(7, 23, 30)))
+	assert.True(t, overnight.Contains(at(7, 7, 59)))
+	assert.False(t, overnight.Contains(at(7, 8, 0)))
+	assert.False(t, overnight.Contains(at(7, 12, 0)))
+	assert.Equal(t, at(8, 8, 0), overnight.End(at(7, 23, 30)))
+	assert.Equal(t, at(7, 8, 0), overnight.End(at(7, 2, 0)))
+
+	lunch, err := ParseWindow("12:00-13:30")
+	require.NoError(t, err)
+	assert.True(t, lunch.Contains(at(7, 13, 0)))
+	assert.False(t, lunch.Contains(at(7, 13, 30)))
+	assert.Equal(t, at(7, 13, 30), lunch.End(at(7, 12, 10)))
+
+	none, err := ParseWindow("")
+	require.NoError(t, err)
+	assert.False(t, none.Contains(at(7, 0, 0)))
+
+	for _, s := range []string{"23:00", "25:00-08:00", "aa:bb-cc:dd"} {
+		_, err := ParseWindow(s)
+		assert.Error(t, err, s)
+	}
+}
+
+type recordingNotifier struct {
+	mux     sync.Mutex
+	batches [][]model.Change
+}
+
+func (r *recordingNotifier) Notify(changes []model.Change) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.batches = append(r.batches, changes)
+	return nil
+}
+
+func (r *recordingNotifier) Batches() [][]model.Change {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.batches
+}
+
+func TestQuietHours_Restart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quiet_hours.json")
+	changes := []model.Change{{
+		TP:         model.Changed,
+		CourseID:   "42",
+		CourseName: "Calculus II",
+		Old:        model.NewGradeRow([]string{"Quiz", "", "5.00", "0–10", "50.00 %"}),
+		New:        model.NewGradeRow([]string{"Quiz", "", "7.00", "0–10", "70.00 %"}),
+		Standing:   &model.Standing{Current: 70, Earned: 7, Graded: 10},
+	}}
+
+	now := sinceMidnight(time.Now())
+	if now < 2*time.Hour || now > 22*time.Hour {
+		t.Skip("the test windows must not wrap around midnight")
+	}
+	quiet := Window{start: now - time.Hour, end: now + time.Hour}
+
+	store, err := NewHeldStore(path)
+	require.NoError(t, err)
+	inner := &recordingNotifier{}
+	require.NoError(t, NewQuietHours(inner, quiet, store, "1").Notify(changes))
+	assert.Empty(t, inner.Batches())
+
+	// After a restart inside the window the changes are held again.
+	store, err = NewHeldStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, changes, store.Load("1"))
+	assert.Empty(t, store.Load("2"))
+	NewQuietHours(inner, quiet, store, "1")
+	assert.Empty(t, inner.Batches())
+
+	// After a restart past the window they are delivered right away.
+	over := Window{start: now - 2*time.Hour, end: now - time.Hour}
+	NewQuietHours(inner, over, store, "1")
+	require.Eventually(t, func() bool { return len(inner.Batches()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, changes, inner.Batches()[0])
+
+	require.Eventually(t, func() bool {
+		store, err := NewHeldStore(path)
+		return err == nil && len(store.Load("1")) == 0
+	}, time.Second, 10*time.Millisecond, "delivered changes are dropped")
+}
@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+)
+
+// Webhook posts the changes as JSON to an arbitrary URL.
+type Webhook struct {
+	client *http.Client
+	url    string
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		client: &http.Client{Timeout: 30 * time.Second},
+		url:    url,
+	}
+}
+
+type webhookGrade struct {
+	Score      string `json:"score"`
+	Range      string `json:"range"`
+	Percentage string `json:"percentage"`
+	Feedback   string `json:"feedback,omitempty"`
+}
+
+type webhookChange struct {
+	Type     string        `json:"type"`
+	CourseID string        `json:"course_id"`
+	Course   string        `json:"course"`
+	Item     string        `json:"item"`
+	Old      *webhookGrade `json:"old,omitempty"`
+	New      *webhookGrade `json:"new,omitempty"`
+}
+
+type webhookPayload struct {
+	SentAt  time.Time       `json:"sent_at"`
+	Changes []webhookChange `json:"changes"`
+}
+
+func toWebhookGrade(gr *model.GradeRow) *webhookGrade {
+	if gr == nil {
+		return nil
+	}
+	return &webhookGrade{
+		Score:      gr.Score,
+		Range:      gr.Rang,
+		Percentage: gr.Percentage,
+		Feedback:   gr.Feedback,
+	}
+}
+
+func (w *Webhook) Notify(changes []model.Change) error {
+	payload := webhookPayload{SentAt: time.Now()}
+	for _, ch := range changes {
+		payload.Changes = append(payload.Changes, webhookChange{
+			Type:     ch.TP.String(),
+			CourseID: ch.CourseID,
+			Course:   ch.CourseName,
+			Item:     ch.ItemName(),
+			Old:      toWebhookGrade(ch.Old),
+			New:      toWebhookGrade(ch.New),
+		})
+	}
+
+	return postJSON(w.client, w.url, payload)
+}
+
+func postJSON(client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error posting webhook: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status: %s", resp.Status)
+	}
+	return nil
+}
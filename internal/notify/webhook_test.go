@@ -0,0 +1,88 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	changes := []model.Change{
+		{
+			TP:         model.Changed,
+			CourseID:   "42",
+			CourseName: "Calculus II",
+			Old:        model.NewGradeRow([]string{"Quiz", "", "5.00", "0–10", "50.00 %"}),
+			New:        model.NewGradeRow([]string{"Quiz", "", "7.00", "0–10", "70.00 %", "Regraded"}),
+		},
+	}
+
+	var bodies []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var body map[string]any
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		bodies = append(bodies, body)
+	}))
+	defer srv.Close()
+
+	err := Fanout{NewWebhook(srv.URL), NewChatWebhook(srv.URL)}.Notify(changes)
+	require.NoError(t, err)
+	require.Len(t, bodies, 2)
+
+	webhookChanges := bodies[0]["changes"].([]any)
+	require.Len(t, webhookChanges, 1)
+	change := webhookChanges[0].(map[string]any)
+	assert.Equal(t, "changed", change["type"])
+	assert.Equal(t, "42", change["course_id"])
+	assert.Equal(t, "Quiz", change["item"])
+	assert.Equal(t, "7.00", change["new"].(map[string]any)["score"])
+
+	expected := "Calculus II\nChanges in Quiz\nOld: 50.00% (5.00/10)\nNew: 70.00% (7.00/10)\nFeedback: Regraded"
+	assert.Equal(t, expected, bodies[1]["content"])
+	assert.Equal(t, expected, bodies[1]["text"])
+}
+
+func TestChatWebhook_Limit(t *testing.T) {
+	course := strings.Repeat("Математика ", 20)
+	var changes []model.Change
+	for i := range 6 {
+		changes = append(changes, model.Change{
+			TP:         model.NewElement,
+			CourseName: course,
+			New:        model.NewGradeRow([]string{fmt.Sprintf("Quiz %d <b>", i), "", "7.00", "0–10", "70.00 %"}),
+		})
+	}
+	changes = append(changes, model.Change{
+		TP:         model.NewElement,
+		CourseName: course,
+		New:        model.NewGradeRow([]string{"Essay", "", "7.00", "0–10", "70.00 %", strings.Repeat("ж", 3000)}),
+	})
+
+	var bodies []chatWebhookPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body chatWebhookPayload
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		bodies = append(bodies, body)
+	}))
+	defer srv.Close()
+
+	require.NoError(t, NewChatWebhook(srv.URL).Notify(changes))
+
+	// Six short changes fit in one message, counted in characters not bytes.
+	require.Len(t, bodies, 2)
+	assert.Equal(t, 6, strings.Count(bodies[0].Content, "Quiz"))
+	assert.Contains(t, bodies[0].Content, "Quiz 0 <b>")
+	assert.Contains(t, bodies[0].Text, "Quiz 0 &lt;b&gt;")
+
+	assert.Equal(t, chatMessageLimit, utf8.RuneCountInString(bodies[1].Content))
+	assert.True(t, strings.HasSuffix(bodies[1].Content, "ж…"))
+}
@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronSchedule_Next(t *testing.T) {
+	// 2025-03-07 is a Friday.
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2025, 3, day, hour, min, 0, 0, time.UTC)
+	}
+
+	testcases := []struct {
+		name     string
+		expr     string
+		after    time.Time
+		expected time.Time
+	}{
+		{name: "every 30 minutes", expr: "*/30 * * * *", after: at(7, 10, 5), expected: at(7, 10, 30)},
+		{name: "strictly after", expr: "*/30 * * * *", after: at(7, 10, 30), expected: at(7, 11, 0)},
+		{name: "working hours", expr: "*/30 8-23 * * *", after: at(7, 23, 45), expected: at(8, 8, 0)},
+		{name: "weekdays skip weekend", expr: "0 8-23 * * mon-fri", after: at(7, 23, 10), expected: at(10, 8, 0)},
+		{name: "list", expr: "15,45 9 * * *", after: at(7, 9, 20), expected: at(7, 9, 45)},
+		{name: "sunday as 7", expr: "0 12 * * 7", after: at(7, 0, 0), expected: at(9, 12, 0)},
+		{name: "day of month or weekday", expr: "0 0 1 * sat", after: at(7, 1, 0), expected: at(8, 0, 0)},
+		{name: "stepped day of month is unrestricted", expr: "0 0 */1 * sat", after: at(8, 1, 0), expected: at(15, 0, 0)},
+		{name: "full weekday range is unrestricted", expr: "0 0 15 * 0-6", after: at(7, 1, 0), expected: at(15, 0, 0)},
+		{name: "month names", expr: "0 0 1 jun *", after: at(7, 1, 0), expected: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := ParseCron(tc.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, s.Next(tc.after))
+		})
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	for _, expr := range []string{"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "* * * * funday"} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -6,20 +6,21 @@ import (
 	"time"
 )
 
-type SyncFunc func() error
+// SyncFunc runs one sync; ctx is cancelled when the scheduler stops.
+type SyncFunc func(ctx context.Context) error
 
 type SyncScheduler struct {
-	interval time.Duration
+	schedule Schedule
 	syncFunc SyncFunc
 
 	innerctx context.Context
 	cancel   context.CancelFunc
 }
 
-func NewSyncScheduler(interval time.Duration, fn SyncFunc) *SyncScheduler {
+func NewSyncScheduler(schedule Schedule, fn SyncFunc) *SyncScheduler {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &SyncScheduler{
-		interval: interval,
+		schedule: schedule,
 		syncFunc: fn,
 		innerctx: ctx,
 		cancel:   cancel,
@@ -27,17 +28,27 @@ func NewSyncScheduler(interval time.Duration, fn SyncFunc) *SyncScheduler {
 }
 
 func (s *SyncScheduler) Run(ctx context.Context) {
-	t := time.NewTicker(s.interval)
-	defer t.Stop()
+	// Stop must abort a running sync as well, not only the wait for the next one.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(s.innerctx, cancel)
+	defer stop()
 
 	for {
-		select {
-		case <-s.innerctx.Done():
+		next := s.schedule.Next(time.Now())
+		if next.IsZero() {
+			slog.Error("sync schedule never fires again, stopping scheduler")
 			return
+		}
+		slog.Debug("next sync scheduled", "at", next)
+
+		t := time.NewTimer(time.Until(next))
+		select {
 		case <-ctx.Done():
+			t.Stop()
 			return
 		case <-t.C:
-			if err := s.syncFunc(); err != nil {
+			if err := s.syncFunc(ctx); err != nil {
 				slog.Error("sync job failed", "error", err)
 			} else {
 				slog.Debug("sync job finished")
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/pkg/utils"
+)
+
+// CookieStore keeps the Moodle session cookies in a file so a restart does
+// not need a new form login. With a key the file is encrypted with AES-GCM.
+type CookieStore struct {
+	path string
+	aead cipher.AEAD
+}
+
+type savedCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// NewCookieStore stores cookies at path. An empty key leaves the file in
+// plain JSON; otherwise the key is hashed into an AES-256 key.
+func NewCookieStore(path, key string) (*CookieStore, error) {
+	s := &CookieStore{path: path}
+	if key == "" {
+		return s, nil
+	}
+
+	var err error
+	s.aead, err = utils.NewAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Load puts the saved cookies into the jar for the given site. It returns
+// os.ErrNotExist when nothing was saved.
+func (s *CookieStore) Load(jar http.CookieJar, site *url.URL) error {
+	buf, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	if s.aead != nil {
+		buf, err = utils.Open(s.aead, buf)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt cookie file: %v", err)
+		}
+	}
+
+	var saved []savedCookie
+	if err := json.Unmarshal(buf, &saved); err != nil {
+		return fmt.Errorf("corrupted cookie file: %v", err)
+	}
+
+	// The jar only gives back name and value, so the cookies are restored
+	// for the whole site.
+	cookies := make([]*http.Cookie, 0, len(saved))
+	for _, c := range saved {
+		cookies = append(cookies, &http.Cookie{Name: c.Name, Value: c.Value, Path: "/"})
+	}
+	jar.SetCookies(site, cookies)
+	return nil
+}
+
+// Save writes the cookies the jar would send to the site.
+func (s *CookieStore) Save(jar http.CookieJar, site *url.URL) error {
+	var saved []savedCookie
+	for _, c := range jar.Cookies(site) {
+		saved = append(saved, savedCookie{Name: c.Name, Value: c.Value})
+	}
+
+	buf, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	if s.aead != nil {
+		buf, err = utils.Seal(s.aead, buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	// A session cookie is as good as the password until it expires.
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Clear removes the saved session.
+func (s *CookieStore) Clear() error {
+	err := os.Remove(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
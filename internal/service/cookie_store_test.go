@@ -0,0 +1,74 @@
+package service
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCookieStore(t *testing.T) {
+	site, err := url.Parse("https://moodle.example.com/my/")
+	require.NoError(t, err)
+
+	testcases := []struct {
+		name string
+		key  string
+	}{
+		{name: "plain"},
+		{name: "encrypted", key: "passphrase"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "cookies.json")
+			store, err := NewCookieStore(path, tc.key)
+			require.NoError(t, err)
+
+			jar, _ := cookiejar.New(nil)
+			require.ErrorIs(t, store.Load(jar, site), os.ErrNotExist)
+
+			jar.SetCookies(site, []*http.Cookie{{Name: "MoodleSession", Value: "abc123", Path: "/"}})
+			require.NoError(t, store.Save(jar, site))
+
+			buf, err := os.ReadFile(path)
+			require.NoError(t, err)
+			// Only the plain file shows the session id.
+			assert.Equal(t, tc.key == "", strings.Contains(string(buf), "abc123"))
+
+			restored, _ := cookiejar.New(nil)
+			require.NoError(t, store.Load(restored, site))
+			cookies := restored.Cookies(site)
+			require.Len(t, cookies, 1)
+			assert.Equal(t, "MoodleSession", cookies[0].Name)
+			assert.Equal(t, "abc123", cookies[0].Value)
+
+			require.NoError(t, store.Clear())
+			require.NoError(t, store.Clear())
+			require.ErrorIs(t, store.Load(restored, site), os.ErrNotExist)
+		})
+	}
+}
+
+func TestCookieStore_WrongKey(t *testing.T) {
+	site, _ := url.Parse("https://moodle.example.com/")
+	path := filepath.Join(t.TempDir(), "cookies.json")
+
+	store, err := NewCookieStore(path, "right")
+	require.NoError(t, err)
+	jar, _ := cookiejar.New(nil)
+	jar.SetCookies(site, []*http.Cookie{{Name: "MoodleSession", Value: "abc123"}})
+	require.NoError(t, store.Save(jar, site))
+
+	other, err := NewCookieStore(path, "wrong")
+	require.NoError(t, err)
+	fresh, _ := cookiejar.New(nil)
+	require.Error(t, other.Load(fresh, site))
+	assert.Empty(t, fresh.Cookies(site))
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/moodletest"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fakeCourses = []moodletest.Course{
+	{ID: 101, Name: "Calculus II", Items: []moodletest.Item{
+		{Name: "Quiz 1", Weight: "10.00 %", Grade: "8.00", Range: "0–10", Percentage: "80.00 %"},
+		{Name: "Midterm", Weight: "30.00 %", Grade: "-", Range: "0–100", Percentage: "-"},
+	}},
+	{ID: 202, Name: "Discrete Mathematics", Items: []moodletest.Item{
+		{Name: "Homework 1", Weight: "5.00 %", Grade: "9.50", Range: "0–10", Percentage: "95.00 %", Feedback: "Well done"},
+	}},
+}
+
+func newTestService(t *testing.T, cfg config.MoodleConfig) *GradeService {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := storage.NewCSVStorage(filepath.Join(dir, "courses"), filepath.Join(dir, "history"))
+	require.NoError(t, err)
+
+	svc := NewGradeService(NewScrapeSource(NewMoodleFetcher(cfg, nil), nil), store, 2)
+	t.Cleanup(func() { svc.Close() })
+	return svc
+}
+
+func changesByItem(changes []model.Change) map[string]model.ChangeType {
+	out := map[string]model.ChangeType{}
+	for _, ch := range changes {
+		out[ch.CourseName+"/"+ch.ItemName()] = ch.TP
+	}
+	return out
+}
+
+func TestParseAndCompare_FakeMoodle(t *testing.T) {
+	srv := moodletest.New(t, "student", "secret", fakeCourses...)
+	svc := newTestService(t, srv.MoodleConfig())
+	ctx := context.Background()
+
+	// The first sync only stores snapshots.
+	changes, err := svc.ParseAndCompare(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, 1, srv.Logins())
+
+	courses, err := svc.GetCourses()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []model.Course{
+		{ID: "101", Name: "Calculus II"},
+		{ID: "202", Name: "Discrete Mathematics"},
+	}, courses)
+
+	rows, err := svc.GetCourseGrades("202")
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, "9.50", rows[0].Score)
+	assert.Equal(t, "Well done", rows[0].Feedback)
+
+	changes, err = svc.ParseAndCompare(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+
+	srv.SetItem(101, moodletest.Item{Name: "Midterm", Weight: "30.00 %", Grade: "72.00", Range: "0–100", Percentage: "72.00 %"})
+	srv.SetItem(101, moodletest.Item{Name: "Quiz 2", Weight: "10.00 %", Grade: "10.00", Range: "0–10", Percentage: "100.00 %"})
+	srv.RemoveItem(202, "Homework 1")
+	srv.SetItem(202, moodletest.Item{Name: "Homework 2", Weight: "5.00 %", Grade: "7.00", Range: "0–10", Percentage: "70.00 %"})
+
+	changes, err = svc.ParseAndCompare(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]model.ChangeType{
+		"Calculus II/Midterm":             model.Changed,
+		"Calculus II/Quiz 2":              model.NewElement,
+		"Discrete Mathematics/Homework 1": model.Removed,
+		"Discrete Mathematics/Homework 2": model.NewElement,
+	}, changesByItem(changes))
+
+	course, history, err := svc.GetHistory("calculus")
+	require.NoError(t, err)
+	assert.Equal(t, "101", course.ID)
+	// Two items of the first snapshot plus the two changes.
+	assert.Len(t, history, 4)
+	assert.Equal(t, 1, srv.Logins())
+
+	// Events recorded under the old name stay with the course.
+	srv.RenameCourse(101, "Calculus II (Spring)")
+	srv.SetItem(101, moodletest.Item{Name: "Quiz 2", Weight: "10.00 %", Grade: "9.00", Range: "0–10", Percentage: "90.00 %"})
+	_, err = svc.ParseAndCompare(ctx)
+	require.NoError(t, err)
+
+	course, history, err = svc.GetHistory("spring")
+	require.NoError(t, err)
+	assert.Equal(t, model.Course{ID: "101", Name: "Calculus II (Spring)"}, course)
+	assert.Len(t, history, 5)
+
+	_, _, err = svc.GetHistory("physics")
+	assert.ErrorIs(t, err, ErrCourseNotFound)
+}
+
+func TestParseAndCompare_SessionExpired(t *testing.T) {
+	srv := moodletest.New(t, "student", "secret", fakeCourses...)
+	svc := newTestService(t, srv.MoodleConfig())
+
+	_, err := svc.ParseAndCompare(context.Background())
+	require.NoError(t, err)
+
+	srv.ExpireSessions()
+	srv.SetItem(202, moodletest.Item{Name: "Homework 1", Weight: "5.00 %", Grade: "10.00", Range: "0–10", Percentage: "100.00 %"})
+
+	changes, err := svc.ParseAndCompare(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]model.ChangeType{
+		"Discrete Mathematics/Homework 1": model.Changed,
+	}, changesByItem(changes))
+	assert.Equal(t, 2, srv.Logins())
+}
+
+func TestMoodleFetcher_Login(t *testing.T) {
+	srv := moodletest.New(t, "student", "secret")
+	ctx := context.Background()
+
+	cfg := srv.MoodleConfig()
+	fetcher := NewMoodleFetcher(cfg, nil)
+	require.ErrorIs(t, fetcher.IsLogined(ctx), ErrNotLogIn)
+	require.NoError(t, fetcher.Login(ctx))
+	require.NoError(t, fetcher.IsLogined(ctx))
+
+	cfg.MoodlePass = "wrong"
+	require.ErrorIs(t, NewMoodleFetcher(cfg, nil).Login(ctx), ErrWrongCredentials)
+
+	// Moodle ends the sessions of an account whose password changed.
+	srv.SetPassword("changed")
+	srv.ExpireSessions()
+	require.NoError(t, NewMoodleFetcher(srv.MoodleConfig(), nil).Login(ctx))
+	require.ErrorIs(t, fetcher.Login(ctx), ErrWrongCredentials)
+}
+
+func TestMoodleFetcher_PersistentSession(t *testing.T) {
+	srv := moodletest.New(t, "student", "secret", fakeCourses...)
+	ctx := context.Background()
+
+	cfg := srv.MoodleConfig()
+	cfg.MoodleCookieFile = filepath.Join(t.TempDir(), "cookies.json")
+	cfg.MoodleCookieKey = "passphrase"
+
+	_, err := NewScrapeSource(NewMoodleFetcher(cfg, nil), nil).Courses(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, srv.Logins())
+
+	// A restarted fetcher reuses the saved session.
+	courses, err := NewScrapeSource(NewMoodleFetcher(cfg, nil), nil).Courses(ctx)
+	require.NoError(t, err)
+	assert.Len(t, courses, 2)
+	assert.Equal(t, 1, srv.Logins())
+
+	// Once Moodle drops it, the fetcher logs in again and saves the new one.
+	srv.ExpireSessions()
+	_, err = NewScrapeSource(NewMoodleFetcher(cfg, nil), nil).Courses(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, srv.Logins())
+
+	_, err = NewScrapeSource(NewMoodleFetcher(cfg, nil), nil).Courses(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, srv.Logins())
+}
+
+func TestMoodleFetcher_LoginUnverified(t *testing.T) {
+	srv := moodletest.New(t, "student", "secret")
+	srv.SetMaintenance(true)
+	ctx := context.Background()
+
+	cfg := srv.MoodleConfig()
+	cfg.MoodleCookieFile = filepath.Join(t.TempDir(), "cookies.json")
+	cfg.MoodleCookieKey = "passphrase"
+
+	// A page that is neither logged in nor a rejection is an error, and its
+	// cookies are not saved.
+	fetcher := NewMoodleFetcher(cfg, nil)
+	err := fetcher.Login(ctx)
+	require.ErrorIs(t, err, ErrNotLogIn)
+	assert.NotErrorIs(t, err, ErrWrongCredentials)
+	assert.NoFileExists(t, cfg.MoodleCookieFile)
+
+	srv.SetMaintenance(false)
+	require.NoError(t, fetcher.Login(ctx))
+	assert.FileExists(t, cfg.MoodleCookieFile)
+}
+
+func TestFindCourse(t *testing.T) {
+	srv := moodletest.New(t, "student", "secret", fakeCourses...)
+	svc := newTestService(t, srv.MoodleConfig())
+	_, err := svc.ParseAndCompare(context.Background())
+	require.NoError(t, err)
+
+	course, err := svc.FindCourse("calc")
+	require.NoError(t, err)
+	assert.Equal(t, "101", course.ID)
+
+	course, err = svc.FindCourse("202")
+	require.NoError(t, err)
+	assert.Equal(t, "Discrete Mathematics", course.Name)
+
+	_, err = svc.FindCourse("c")
+	assert.ErrorIs(t, err, ErrAmbiguousCourse)
+
+	_, err = svc.FindCourse("physics")
+	assert.ErrorIs(t, err, ErrCourseNotFound)
+}
@@ -3,7 +3,10 @@ package service
 import (
 	"bytes"
 	"fmt"
+	"net/url"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
@@ -11,7 +14,7 @@ import (
 	"golang.org/x/net/html"
 )
 
-func extractGradesLinks(htmlContent []byte, badTitles []string) (links []string, err error) {
+func extractGradesLinks(htmlContent []byte, badTitles []string) (courses []model.Course, err error) {
 	doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(htmlContent))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse HTML content: %v", err)
@@ -22,18 +25,33 @@ func extractGradesLinks(htmlContent []byte, badTitles []string) (links []string,
 			return
 		}
 		linkSel := tr.Find("td.c0 a").First()
+		title := linkSel.Text()
 
-		if slices.Contains(badTitles, linkSel.Text()) {
+		if slices.Contains(badTitles, title) {
 			return
 		}
 
 		href, _ := linkSel.Attr("href")
-		links = append(links, href)
+		courses = append(courses, model.Course{
+			ID:   courseIDFromLink(href),
+			Name: trim(title),
+			URL:  href,
+		})
 	})
 
 	return
 }
 
+// courseIDFromLink returns the course id of a grade report link such as
+// /course/user.php?mode=grade&id=123&user=4 or /grade/report/user/index.php?id=123.
+func courseIDFromLink(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return u.Query().Get("id")
+}
+
 func extractItems(htmlContent []byte) (courseName string, rows []*model.GradeRow, err error) {
 	doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(htmlContent))
 	if err != nil {
@@ -45,34 +63,231 @@ func extractItems(htmlContent []byte) (courseName string, rows []*model.GradeRow
 		return "", nil, fmt.Errorf("failed to extract course name")
 	}
 
+	columns := extractColumns(doc.Find("table.user-grade thead tr").Last())
+
+	var categories categoryStack
 	doc.Find("table.user-grade tbody tr").Each(func(i int, tr *goquery.Selection) {
-		// isAggregation := tr.Find("span[title='Aggregation']").First()
-		// if isAggregation.Length() > 0 {
-		// 	return
-		// }
+		th := tr.Find("th").First()
+		level := rowLevel(th)
+		if th.HasClass("category") {
+			categories.push(level, trim(th.Find("div.rowtitle").Text()))
+			return
+		}
+		categories.leave(level)
 
-		var row []string
-		thName := tr.Find("th").First().Find("div.rowtitle").Children().First().Text()
+		thName := th.Find("div.rowtitle").Children().First().Text()
 		// slog.Debug("Extracted thname", "thname", thName)
+		if trim(thName) == "" {
+			// Totals start with the aggregation icon.
+			thName = th.Find("div.rowtitle").Text()
+		}
 
 		if thName == "" {
 			return
 		}
 
-		row = append(row, trim(thName))
+		tds := tr.Find("td")
+		if tds.Length() == 0 {
+			return
+		}
+
+		row := make([]string, model.NumColumns)
+		row[model.ColName] = trim(thName)
+		row[model.ColCategory] = categories.path()
+		if isAggregation(tr) {
+			row[model.ColKind] = string(model.CategoryTotalRow)
+			if categories.depth() <= 1 {
+				row[model.ColKind] = string(model.CourseTotalRow)
+			}
+		}
 
-		tr.Find("td").Each(func(i int, s *goquery.Selection) {
-			row = append(row, (firstTextNode(s)))
+		// Leading spacer cells of nested categories have no header, so
+		// cells without a column class are aligned to the headers from the right.
+		offset := len(columns) - tds.Length()
+		tds.Each(func(i int, s *goquery.Selection) {
+			col, ok := columnByClass(s)
+			if !ok {
+				if i+offset < 0 || i+offset >= len(columns) {
+					return
+				}
+				col, ok = columns[i+offset], true
+			}
+			if col != model.ColName {
+				row[col] = firstTextNode(s)
+			}
 		})
 
-		if len(row) == 7 {
-			rows = append(rows, model.NewGradeRow(row))
+		rows = append(rows, model.NewGradeRow(row))
+	})
+
+	return
+}
+
+// isAggregation reports whether a report row is a category or course total
+// rather than a grade item.
+func isAggregation(tr *goquery.Selection) bool {
+	th := tr.Find("th").First()
+	return tr.Find("[title='Aggregation']").Length() > 0 ||
+		th.HasClass("baggt") || th.HasClass("baggb") ||
+		strings.EqualFold(trim(th.Text()), "Course total")
+}
+
+var levelPattern = regexp.MustCompile(`^level(\d+)$`)
+
+// rowLevel returns the nesting level from the levelN class of a report cell,
+// or 0 when the report has none.
+func rowLevel(th *goquery.Selection) int {
+	class, _ := th.Attr("class")
+	for _, c := range strings.Fields(class) {
+		if m := levelPattern.FindStringSubmatch(c); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			return n
+		}
+	}
+	return 0
+}
+
+// categoryStack tracks the categories enclosing the current report row. The
+// first category is the course itself.
+type categoryStack struct {
+	levels []int
+	names  []string
+}
+
+func (c *categoryStack) push(level int, name string) {
+	if level == 0 {
+		// Without level classes nesting is unknown, so categories are
+		// taken as children of the course category.
+		c.levels, c.names = c.levels[:min(len(c.levels), 1)], c.names[:min(len(c.names), 1)]
+	} else {
+		c.leave(level)
+	}
+	c.levels = append(c.levels, level)
+	c.names = append(c.names, name)
+}
+
+// leave closes the categories a row at level is no longer part of. Items of
+// a category at level N are at level N+1.
+func (c *categoryStack) leave(level int) {
+	if level == 0 {
+		return
+	}
+	for len(c.levels) > 0 && c.levels[len(c.levels)-1] >= level {
+		c.levels = c.levels[:len(c.levels)-1]
+		c.names = c.names[:len(c.names)-1]
+	}
+}
+
+func (c *categoryStack) depth() int {
+	return len(c.names)
+}
+
+func (c *categoryStack) path() string {
+	return strings.Join(c.names, model.CategorySeparator)
+}
+
+// defaultColumns is the layout of the user grade report with Moodle's default
+// settings; it is used when the table has no header row.
+var defaultColumns = []model.Column{
+	model.ColWeight,
+	model.ColScore,
+	model.ColRange,
+	model.ColPercentage,
+	model.ColFeedback,
+	model.ColContribution,
+}
+
+// extractColumns maps the data columns (everything after the grade item
+// column) of the report header to GradeRow columns. Unknown headers map to
+// ColName and are ignored when filling rows.
+func extractColumns(headerRow *goquery.Selection) []model.Column {
+	ths := headerRow.Find("th")
+	if ths.Length() == 0 {
+		return defaultColumns
+	}
+
+	var columns []model.Column
+	ths.Each(func(i int, th *goquery.Selection) {
+		col, ok := columnByClass(th)
+		if !ok {
+			col, ok = columnByHeader(th.Text())
+		}
+		if !ok {
+			col = model.ColName
+		}
+
+		// The item name header is not a data column.
+		if i == 0 && col == model.ColName {
+			return
+		}
 
+		colspan, _ := th.Attr("colspan")
+		span, err := strconv.Atoi(colspan)
+		if err != nil || span < 1 {
+			span = 1
+		}
+		for range span {
+			columns = append(columns, col)
 		}
 	})
 
-	return
+	return columns
+}
+
+var columnClasses = map[string]model.Column{
+	"column-itemname":                  model.ColName,
+	"column-weight":                    model.ColWeight,
+	"column-grade":                     model.ColScore,
+	"column-range":                     model.ColRange,
+	"column-percentage":                model.ColPercentage,
+	"column-feedback":                  model.ColFeedback,
+	"column-contributiontocoursetotal": model.ColContribution,
+	"column-lettergrade":               model.ColLetterGrade,
+	"column-rank":                      model.ColRank,
+	"column-average":                   model.ColAverage,
 }
+
+func columnByClass(s *goquery.Selection) (model.Column, bool) {
+	class, _ := s.Attr("class")
+	for _, c := range strings.Fields(class) {
+		if col, ok := columnClasses[c]; ok {
+			return col, true
+		}
+	}
+	return 0, false
+}
+
+// columnByHeader matches the header caption. Order matters: "Letter grade"
+// and "Grade item" must not be taken for the grade column.
+func columnByHeader(header string) (model.Column, bool) {
+	h := strings.ToLower(trim(header))
+	switch {
+	case h == "":
+		return 0, false
+	case strings.Contains(h, "grade item"):
+		return model.ColName, true
+	case strings.Contains(h, "weight"):
+		return model.ColWeight, true
+	case strings.Contains(h, "contribution"):
+		return model.ColContribution, true
+	case strings.Contains(h, "letter"):
+		return model.ColLetterGrade, true
+	case strings.Contains(h, "rank"):
+		return model.ColRank, true
+	case strings.Contains(h, "average"):
+		return model.ColAverage, true
+	case strings.Contains(h, "range"):
+		return model.ColRange, true
+	case strings.Contains(h, "percentage"):
+		return model.ColPercentage, true
+	case strings.Contains(h, "feedback"):
+		return model.ColFeedback, true
+	case strings.Contains(h, "grade"):
+		return model.ColScore, true
+	}
+	return 0, false
+}
+
 func trim(s string) string {
 	s = strings.ReplaceAll(s, "\t", "")
 	s = strings.ReplaceAll(s, "\n", "")
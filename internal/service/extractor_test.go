@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userGradePage = `<html><body>
+<div class="page-header-headings"><h1>Calculus II</h1></div>
+<table class="user-grade">
+<thead><tr>
+	<th class="header column-itemname">Grade item</th>
+	%s
+</tr></thead>
+<tbody>
+	<tr><th class="category column-itemname"><div class="rowtitle"><span>Homework</span></div></th></tr>
+	%s
+</tbody>
+</table>
+</body></html>`
+
+func TestExtractItems(t *testing.T) {
+	testcases := []struct {
+		name     string
+		headers  string
+		rows     string
+		expected []*model.GradeRow
+	}{
+		{
+			name: "default columns",
+			headers: `<th>Calculated weight</th><th>Grade</th><th>Range</th><th>Percentage</th>
+				<th>Feedback</th><th>Contribution to course total</th>`,
+			rows: `<tr><th><div class="rowtitle"><a>Quiz 1</a></div></th>
+				<td>10.00 %</td><td>8.00</td><td>0–10</td><td>80.00 %</td><td>Good</td><td>8.00 %</td></tr>`,
+			expected: []*model.GradeRow{
+				model.NewGradeRow([]string{"Quiz 1", "10.00 %", "8.00", "0–10", "80.00 %", "Good", "8.00 %", "", "", "", "", "Homework"}),
+			},
+		},
+		{
+			name:    "hidden and extra columns",
+			headers: `<th>Grade</th><th>Letter grade</th><th>Range</th><th>Rank</th><th>Percentage</th>`,
+			rows: `<tr><th><div class="rowtitle"><a>Midterm</a></div></th>
+				<td>45.00</td><td>B+</td><td>0–50</td><td>3/40</td><td>90.00 %</td></tr>`,
+			expected: []*model.GradeRow{
+				model.NewGradeRow([]string{"Midterm", "", "45.00", "0–50", "90.00 %", "", "", "B+", "3/40", "", "", "Homework"}),
+			},
+		},
+		{
+			name:    "column classes and category spacer",
+			headers: `<th class="column-percentage">%</th><th class="column-grade">Mark</th>`,
+			rows: `<tr><th><div class="rowtitle"><a>Lab</a></div></th>
+				<td class="b1l"></td><td class="column-percentage">50.00 %</td><td class="column-grade">5.00</td></tr>`,
+			expected: []*model.GradeRow{
+				model.NewGradeRow([]string{"Lab", "", "5.00", "", "50.00 %", "", "", "", "", "", "", "Homework"}),
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			page := []byte(fmt.Sprintf(userGradePage, tc.headers, tc.rows))
+
+			courseName, rows, err := extractItems(page)
+			require.NoError(t, err)
+			assert.Equal(t, "Calculus II", courseName)
+			assert.Equal(t, tc.expected, rows)
+		})
+	}
+}
+
+const nestedGradePage = `<html><body>
+<div class="page-header-headings"><h1>Calculus II</h1></div>
+<table class="user-grade">
+<thead><tr>
+	<th class="header column-itemname" colspan="3">Grade item</th>
+	<th class="header column-weight">Calculated weight</th>
+	<th class="header column-grade">Grade</th>
+	<th class="header column-range">Range</th>
+</tr></thead>
+<tbody>
+	<tr><th class="level1 levelodd category column-itemname" colspan="6"><div class="rowtitle"><span>Calculus II</span></div></th></tr>
+	<tr><td class="level1 spacer"></td>
+		<th class="level2 leveleven item column-itemname"><div class="rowtitle"><a>Midterm</a></div></th>
+		<td class="column-weight">60.00 %</td><td class="column-grade">70.00</td><td class="column-range">0–100</td></tr>
+	<tr><td class="level1 spacer"></td>
+		<th class="level2 leveleven category column-itemname" colspan="5"><div class="rowtitle"><span>Homework</span></div></th></tr>
+	<tr><td class="level1 spacer"></td><td class="level2 spacer"></td>
+		<th class="level3 levelodd item column-itemname"><div class="rowtitle"><a>HW 1</a></div></th>
+		<td class="column-weight">50.00 %</td><td class="column-grade">9.00</td><td class="column-range">0–10</td></tr>
+	<tr><td class="level1 spacer"></td><td class="level2 spacer"></td>
+		<th class="level3 levelodd item baggb column-itemname"><div class="rowtitle"><span title="Aggregation"></span><span>Homework total</span></div></th>
+		<td class="column-weight">40.00 %</td><td class="column-grade">9.00</td><td class="column-range">0–10</td></tr>
+	<tr><td class="level1 spacer"></td>
+		<th class="level2 leveleven item baggb column-itemname"><div class="rowtitle"><span title="Aggregation"></span><span>Course total</span></div></th>
+		<td class="column-weight">-</td><td class="column-grade">78.00</td><td class="column-range">0–100</td></tr>
+</tbody>
+</table>
+</body></html>`
+
+func TestExtractItems_Categories(t *testing.T) {
+	_, rows, err := extractItems([]byte(nestedGradePage))
+	require.NoError(t, err)
+
+	assert.Equal(t, []*model.GradeRow{
+		model.NewGradeRow([]string{"Midterm", "60.00 %", "70.00", "0–100", "", "", "", "", "", "", "", "Calculus II"}),
+		model.NewGradeRow([]string{"HW 1", "50.00 %", "9.00", "0–10", "", "", "", "", "", "", "", "Calculus II / Homework"}),
+		model.NewGradeRow([]string{"Homework total", "40.00 %", "9.00", "0–10", "", "", "", "", "", "", string(model.CategoryTotalRow), "Calculus II / Homework"}),
+		model.NewGradeRow([]string{"Course total", "-", "78.00", "0–100", "", "", "", "", "", "", string(model.CourseTotalRow), "Calculus II"}),
+	}, rows)
+}
@@ -2,17 +2,21 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"os"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
 	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
 )
 
 var (
@@ -23,6 +27,10 @@ var (
 type MoodleFetcher struct {
 	loginGroup singleflight.Group
 	client     *http.Client
+	retry      RetryPolicy
+	// cookies persists the session between restarts, nil when disabled.
+	cookies *CookieStore
+	siteURL *url.URL
 
 	user       string
 	pass       string
@@ -31,16 +39,46 @@ type MoodleFetcher struct {
 	gradesPage string
 }
 
-func NewMoodleFetcher(cfg config.MoodleConfig) *MoodleFetcher {
+func NewMoodleFetcher(cfg config.MoodleConfig, limiter *rate.Limiter) *MoodleFetcher {
 	jar, err := cookiejar.New(nil)
 	if err != nil {
 		panic(err)
 	}
 
+	siteURL, err := url.Parse(cfg.MoodleMainPage)
+	if err != nil {
+		panic(err)
+	}
+
+	var cookies *CookieStore
+	if cfg.MoodleCookieFile != "" {
+		cookies, err = NewCookieStore(cfg.MoodleCookieFile, cfg.MoodleCookieKey)
+		if err != nil {
+			panic(err)
+		}
+
+		err = cookies.Load(jar, siteURL)
+		switch {
+		case err == nil:
+			slog.Debug("Restored Moodle session", "file", cfg.MoodleCookieFile)
+		case !errors.Is(err, os.ErrNotExist):
+			slog.Warn("Failed to restore Moodle session, logging in again", "file", cfg.MoodleCookieFile, "error", err)
+		}
+	}
+
 	return &MoodleFetcher{
 		loginGroup: singleflight.Group{},
+		cookies:    cookies,
+		siteURL:    siteURL,
 		client: &http.Client{
-			Jar: jar,
+			Jar:       jar,
+			Transport: newMoodleTransport(cfg, limiter),
+			Timeout:   cfg.MoodleRequestTimeout,
+		},
+		retry: RetryPolicy{
+			MaxAttempts: cfg.MoodleRetryMaxAttempts,
+			BaseDelay:   cfg.MoodleRetryBaseDelay,
+			MaxDelay:    cfg.MoodleRetryMaxDelay,
 		},
 		user:       cfg.MoodleUser,
 		pass:       cfg.MoodlePass,
@@ -50,10 +88,17 @@ func NewMoodleFetcher(cfg config.MoodleConfig) *MoodleFetcher {
 	}
 }
 
-func (gp *MoodleFetcher) IsLogined() error {
-	resp, err := gp.client.Get(gp.mainPage)
+// get is an idempotent GET with the retry policy applied.
+func (gp *MoodleFetcher) get(ctx context.Context, link string) (*http.Response, error) {
+	return gp.retry.Do(ctx, gp.client, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, link, nil)
+	})
+}
+
+func (gp *MoodleFetcher) IsLogined(ctx context.Context) error {
+	resp, err := gp.get(ctx, gp.mainPage)
 	if err != nil {
-		return fmt.Errorf("error checking login status: %v", err)
+		return fmt.Errorf("error checking login status: %w", err)
 	}
 
 	defer resp.Body.Close()
@@ -71,14 +116,38 @@ func (gp *MoodleFetcher) IsLogined() error {
 		return nil
 	}
 
+	gp.clearSession()
 	return ErrNotLogIn
 }
-func (gp *MoodleFetcher) Login() error {
+
+// saveSession stores the cookies of a successful login.
+func (gp *MoodleFetcher) saveSession() {
+	if gp.cookies == nil {
+		return
+	}
+	if err := gp.cookies.Save(gp.client.Jar, gp.siteURL); err != nil {
+		slog.Warn("Failed to save Moodle session", "error", err)
+	}
+}
+
+// clearSession drops a saved session that Moodle no longer accepts.
+func (gp *MoodleFetcher) clearSession() {
+	if gp.cookies == nil {
+		return
+	}
+	if err := gp.cookies.Clear(); err != nil {
+		slog.Warn("Failed to remove Moodle session", "error", err)
+	}
+}
+
+// Login submits the login form. Concurrent calls share one attempt, which
+// runs with the context of the first caller.
+func (gp *MoodleFetcher) Login(ctx context.Context) error {
 	_, err, _ := gp.loginGroup.Do("login", func() (interface{}, error) {
 
-		loginPageResp, err := gp.client.Get(gp.loginPage)
+		loginPageResp, err := gp.get(ctx, gp.loginPage)
 		if err != nil {
-			return nil, fmt.Errorf("error fetching login page: %v", err)
+			return nil, fmt.Errorf("error fetching login page: %w", err)
 		}
 		defer loginPageResp.Body.Close()
 
@@ -139,57 +208,64 @@ func (gp *MoodleFetcher) Login() error {
 		data.Set("username", gp.user)
 		data.Set("password", gp.pass)
 
-		resp, err := gp.client.PostForm(actionURL.String(), data)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, actionURL.String(), strings.NewReader(data.Encode()))
 		if err != nil {
 			return nil, err
 		}
-		defer resp.Body.Close()
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 
-		// Read response body for quick checks
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		bodyStr := string(bodyBytes)
+		resp, err := gp.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
 
-		if resp.Request != nil {
-			finalURL := resp.Request.URL.String()
+		page, err := goquery.NewDocumentFromReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse login response HTML: %v", err)
+		}
 
-			if strings.Contains(finalURL, "/my/") || strings.Contains(strings.ToLower(bodyStr), "log out") || strings.Contains(strings.ToLower(bodyStr), "dashboard") {
-				return nil, nil
-			}
+		// Only a page of a logged-in user proves the cookies are a session
+		// worth keeping.
+		if page.Find("a[href*='logout']").Length() > 0 || resp.Request.URL.String() == gp.mainPage {
+			gp.saveSession()
+			return nil, nil
 		}
 
-		if strings.Contains(strings.ToLower(bodyStr), "invalid") || strings.Contains(strings.ToLower(bodyStr), "incorrect") {
+		text := strings.ToLower(page.Text())
+		if strings.Contains(text, "invalid") || strings.Contains(text, "incorrect") {
 			return nil, ErrWrongCredentials
 		}
 
-		return nil, err
+		return nil, fmt.Errorf("%w: login ended on %s", ErrNotLogIn, resp.Request.URL)
 	})
-
 	return err
 }
 
-func (gp *MoodleFetcher) GetGradesPage() ([]byte, error) {
-	return gp.Fetch(gp.gradesPage)
+func (gp *MoodleFetcher) GetGradesPage(ctx context.Context) ([]byte, error) {
+	return gp.Fetch(ctx, gp.gradesPage)
 }
 
-func (gp *MoodleFetcher) Fetch(link string) ([]byte, error) {
-	resp, err := gp.client.Get(link)
+func (gp *MoodleFetcher) Fetch(ctx context.Context, link string) ([]byte, error) {
+	resp, err := gp.get(ctx, link)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching grades page: %v", err)
+		return nil, fmt.Errorf("error fetching grades page: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.Request.URL.String() != link {
 
-		err := gp.Login()
+		err := gp.Login(ctx)
 		if err != nil {
-			return nil, fmt.Errorf("re-login failed: %v", err)
+			return nil, fmt.Errorf("re-login failed: %w", err)
 		}
 
 		resp.Body.Close()
-		resp, err = gp.client.Get(link)
+		resp, err = gp.get(ctx, link)
 		if err != nil {
-			return nil, fmt.Errorf("error fetching grades page: %v", err)
+			return nil, fmt.Errorf("error fetching grades page: %w", err)
 		}
+		defer resp.Body.Close()
 	}
 
 	// slog.Debug("Fetched  page",
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"strings"
@@ -13,23 +15,29 @@ import (
 	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/storage"
 )
 
-var ErrInProgress = errors.New("❗️ already in progress")
+var (
+	ErrInProgress      = errors.New("❗️ already in progress")
+	ErrClosed          = errors.New("❗️ grade service is closed")
+	ErrCourseNotFound  = errors.New("❗️ course not found")
+	ErrAmbiguousCourse = errors.New("❗️ several courses match")
+)
 
 type GradeService struct {
 	isRunning      atomic.Bool
+	closed         atomic.Bool
 	LastTimeParsed time.Time
 
-	csvWriter *storage.CSVwriter
-	fetcher   *MoodleFetcher
-
-	badTitles []string
+	store  storage.Storage
+	source GradeSource
+	// workers is how many courses are fetched at the same time.
+	workers int
 }
 
-func NewGradeService(fetcher *MoodleFetcher, csvWriter *storage.CSVwriter, badTitles []string) *GradeService {
+func NewGradeService(source GradeSource, store storage.Storage, workers int) *GradeService {
 	return &GradeService{
-		fetcher:   fetcher,
-		csvWriter: csvWriter,
-		badTitles: badTitles,
+		source:  source,
+		store:   store,
+		workers: max(workers, 1),
 	}
 }
 
@@ -39,73 +47,112 @@ func (p *GradeService) WaitTillFinishedRunning() {
 	}
 }
 
-func (p *GradeService) ParseAndCompare() ([]model.Change, error) {
+// ParseAndCompare fetches every course, stores the new snapshots and returns
+// the changes. If ctx is done midway the changes of the courses finished so
+// far are returned together with the context error.
+func (p *GradeService) ParseAndCompare(ctx context.Context) ([]model.Change, error) {
+	if p.closed.Load() {
+		return nil, ErrClosed
+	}
 	if !p.isRunning.CompareAndSwap(false, true) {
 		slog.Debug("ParseAndCompare:already_running")
 		return nil, ErrInProgress
 	}
 	defer p.isRunning.Store(false)
 
-	if err := p.fetcher.IsLogined(); err != nil {
-		err = p.fetcher.Login()
-		if err != nil {
-			slog.Error("Login failed", "error", err)
-		}
-	}
-
-	buf, err := p.fetcher.GetGradesPage()
-	if err != nil {
-		return nil, err
-	}
-
-	links, err := extractGradesLinks(buf, p.badTitles)
+	courses, err := p.source.Courses(ctx)
 	if err != nil {
 		return nil, err
 	}
-	slog.Debug("Successfully extracted links", "len", len(links))
+	slog.Debug("Successfully fetched courses", "len", len(courses))
 
+	observedAt := time.Now()
 	var wg sync.WaitGroup
 	var mux sync.Mutex
+	sem := make(chan struct{}, p.workers)
 	var TotalChanges []model.Change
-	for _, link := range links {
-		slog.Debug("Processing link", "link", link)
+	var events []model.GradeEvent
+	for _, course := range courses {
+		slog.Debug("Processing course", "course", course.Name, "link", course.URL)
 		wg.Go(func() {
-			buf, err := p.fetcher.Fetch(link)
-			if err != nil {
-				slog.Error("Failed to fetch grade page", "link", link, "error", err)
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
 			}
+			defer func() { <-sem }()
 
-			courseName, newItems, err := extractItems(buf)
+			courseName, newItems, err := p.source.CourseGrades(ctx, course)
 			if err != nil {
-				slog.Error("Failed to extract items", "link", link, "error", err)
+				slog.Error("Failed to get course grades", "course", course.Name, "error", err)
 				return
 			}
+			if courseName != "" {
+				course.Name = courseName
+			}
+			if course.ID == "" {
+				slog.Warn("Course has no id, keying it by name", "course", course.Name)
+				course.ID = course.Name
+			}
+
+			moved, err := p.store.MigrateCourse(storage.CourseInfo{ID: course.ID, Name: course.Name})
+			if err != nil {
+				slog.Error("Failed to migrate course snapshot", "course", course.Name, "id", course.ID, "error", err)
+			} else if moved {
+				slog.Info("Migrated course snapshot to course id", "course", course.Name, "id", course.ID)
+			}
 
-			oldItems, err := p.readItemsCourse(courseName)
+			oldItems, err := p.readItemsCourse(course.ID)
 			exists := !errors.Is(err, os.ErrNotExist)
 			if err != nil && exists {
-				slog.Error("Failed to read old items", "course", courseName, "error", err)
+				slog.Error("Failed to read old items", "course", course.Name, "error", err)
 				return
 			}
 
-			if exists {
-				CourseChanges := Compare(courseName, oldItems, newItems)
-				slog.Debug("Course changes found", "course", courseName, "count", len(CourseChanges))
+			// An empty report for a course that had items is most likely a
+			// broken page, not every item being removed at once.
+			if exists && len(newItems) == 0 && len(oldItems) > 0 {
+				slog.Warn("No items extracted, keeping old snapshot", "course", course.Name, "old", len(oldItems))
+				return
+			}
+
+			// The first snapshot of a course is not announced, but it is the
+			// starting point of the course history.
+			CourseChanges := Compare(course, oldItems, newItems)
+			if standing, ok := model.ComputeStanding(newItems); ok {
+				for i := range CourseChanges {
+					CourseChanges[i].Standing = &standing
+				}
+			}
+			slog.Debug("Course changes found", "course", course.Name, "count", len(CourseChanges), "exists", exists)
 
-				mux.Lock()
+			mux.Lock()
+			if exists {
 				TotalChanges = append(TotalChanges, CourseChanges...)
-				mux.Unlock()
 			}
+			for _, ch := range CourseChanges {
+				events = append(events, model.NewGradeEvent(ch, observedAt))
+			}
+			mux.Unlock()
 
-			err = p.writeItems(courseName, newItems)
+			err = p.writeItems(course, newItems)
 			if err != nil {
-				slog.Error("Failed to write new items", "course", courseName, "error", err)
+				slog.Error("Failed to write new items", "course", course.Name, "error", err)
 			}
 		})
 	}
 
 	wg.Wait()
 
+	if err := p.appendHistory(events); err != nil {
+		slog.Error("Failed to append grade history", "events", len(events), "error", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		slog.Warn("ParseAndCompare:interrupted", "total_changes", len(TotalChanges), "error", err)
+		return TotalChanges, fmt.Errorf("sync interrupted: %w", err)
+	}
+
 	p.LastTimeParsed = time.Now()
 	slog.Debug("ParseAndCompare:done", "total_changes", len(TotalChanges))
 	return TotalChanges, nil
@@ -115,47 +162,35 @@ func (p *GradeService) GetLastTimeParsed() time.Time {
 	slog.Debug("GetLastTimeParsed", "last", p.LastTimeParsed)
 	return p.LastTimeParsed
 }
-func buildFilePath(courseName string) string {
-	path := sanitizeFilename(courseName) + "_grades.csv"
-	return path
-}
 
-func sanitizeFilename(name string) string {
-	// Replace common invalid filename characters with underscores
-	invalidChars := []string{" ", ":", "/", "\\", "*", "?", "\"", "<", ">", "|"}
-	for _, char := range invalidChars {
-		name = strings.ReplaceAll(name, char, "_")
-	}
-	// Trim whitespace and limit length to avoid issues
-	name = strings.TrimSpace(name)
-	if len(name) > 255 {
-		name = name[:255]
+// Close waits for a running sync to finish and closes the storage. Syncs
+// started afterwards fail with ErrClosed.
+func (p *GradeService) Close() error {
+	// The running flag is never released, which keeps further syncs out.
+	for !p.isRunning.CompareAndSwap(false, true) {
+		if p.closed.Load() {
+			return nil
+		}
+		time.Sleep(100 * time.Millisecond)
 	}
-	slog.Debug("sanitizeFilename", "result", name)
-	return name
+	p.closed.Store(true)
+	return p.store.Close()
 }
-
-func (p *GradeService) writeItems(courseName string, items []*model.GradeRow) error {
-	slog.Debug("writeItems", "course", courseName, "items", len(items))
+func (p *GradeService) writeItems(course model.Course, items []*model.GradeRow) error {
+	slog.Debug("writeItems", "course", course.Name, "id", course.ID, "items", len(items))
 
 	record := make([][]string, 0, len(items))
 	for _, item := range items {
 		record = append(record, item.ToStringSlice())
 	}
 
-	return p.csvWriter.Write(buildFilePath(courseName), record)
+	return p.store.WriteCourse(storage.CourseInfo{ID: course.ID, Name: course.Name}, record)
 }
 
-func (p *GradeService) readItemsCourse(courseName string) ([]*model.GradeRow, error) {
-	slog.Debug("readItemsCourse", "course", courseName)
+func (p *GradeService) readItemsCourse(courseID string) ([]*model.GradeRow, error) {
+	slog.Debug("readItemsCourse", "id", courseID)
 
-	return p.readItemsFile(buildFilePath(courseName))
-}
-
-func (p *GradeService) readItemsFile(courseFilePath string) ([]*model.GradeRow, error) {
-	slog.Debug("readItems", "course", courseFilePath)
-
-	records, err := p.csvWriter.Read(courseFilePath)
+	records, err := p.store.ReadCourse(courseID)
 	if err != nil {
 		return nil, err
 	}
@@ -168,46 +203,118 @@ func (p *GradeService) readItemsFile(courseFilePath string) ([]*model.GradeRow,
 	return rows, nil
 }
 
-func (p *GradeService) GetCourseNamesList() ([]string, error) {
-	files, err := p.csvWriter.ListFiles()
+// GetCourses returns the stored courses. Their URL is not stored and is empty.
+func (p *GradeService) GetCourses() ([]model.Course, error) {
+	infos, err := p.store.ListCourses()
 	if err != nil {
 		return nil, err
 	}
-	slog.Debug("GetCourseNamesList", "files", len(files))
+	slog.Debug("GetCourses", "courses", len(infos))
 
-	return files, nil
+	courses := make([]model.Course, 0, len(infos))
+	for _, info := range infos {
+		courses = append(courses, model.Course{ID: info.ID, Name: info.Name})
+	}
+	return courses, nil
 }
 
-func (p *GradeService) GetCourseGrades(courseName string) ([]*model.GradeRow, error) {
-	slog.Debug("GetCourseGrades", "course", courseName)
-	return p.readItemsCourse(courseName)
+// FindCourse returns the stored course whose id is query or whose name
+// contains it (case-insensitive). An exact name match wins over partial ones.
+func (p *GradeService) FindCourse(query string) (model.Course, error) {
+	courses, err := p.GetCourses()
+	if err != nil {
+		return model.Course{}, err
+	}
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	var matches []model.Course
+	for _, c := range courses {
+		name := strings.ToLower(c.Name)
+		if c.ID == query || name == query {
+			return c, nil
+		}
+		if strings.Contains(name, query) {
+			matches = append(matches, c)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return model.Course{}, fmt.Errorf("%w: %s", ErrCourseNotFound, query)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, c := range matches {
+		names[i] = c.Name
+	}
+	return model.Course{}, fmt.Errorf("%w: %s", ErrAmbiguousCourse, strings.Join(names, ", "))
+}
+
+func (p *GradeService) GetCourseGrades(courseID string) ([]*model.GradeRow, error) {
+	slog.Debug("GetCourseGrades", "id", courseID)
+	return p.readItemsCourse(courseID)
 }
 
-func (p *GradeService) GetCourseFile(coursefile string) ([]*model.GradeRow, error) {
-	slog.Debug("GetCourseFile", "course", coursefile)
-	return p.readItemsFile(coursefile)
+// GetAllCourseGrades returns the stored rows of every course.
+func (p *GradeService) GetAllCourseGrades() ([]model.CourseGrades, error) {
+	courses, err := p.GetCourses()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]model.CourseGrades, 0, len(courses))
+	for _, course := range courses {
+		rows, err := p.readItemsCourse(course.ID)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", course.Name, err)
+		}
+		out = append(out, model.CourseGrades{Course: course, Rows: rows})
+	}
+	return out, nil
 }
 
-func Compare(courseName string, old, new []*model.GradeRow) []model.Change {
-	slog.Debug("Compare:start", "course", courseName, "old", len(old), "new", len(new))
+// Compare returns the changes between two snapshots of a course. Category and
+// course totals are not announced; they move with every item. Items are
+// matched by category and name, so same-named items in different categories
+// are told apart; old rows without a category are matched by name alone.
+func Compare(course model.Course, old, new []*model.GradeRow) []model.Change {
+	slog.Debug("Compare:start", "course", course.Name, "old", len(old), "new", len(new))
 	mp := map[string]*model.GradeRow{}
+	legacy := map[string]*model.GradeRow{}
 	for _, s := range old {
-		mp[s.AssName] = s
+		mp[rowKey(s)] = s
+		if s.Category == "" {
+			legacy[s.AssName] = s
+		}
 	}
 
+	matched := map[*model.GradeRow]bool{}
 	var changes []model.Change
 	for _, s := range new {
-		old, ok := mp[s.AssName]
+		old, ok := mp[rowKey(s)]
+		if !ok || matched[old] {
+			old, ok = legacy[s.AssName]
+		}
+		ok = ok && !matched[old]
+		if ok {
+			matched[old] = true
+		}
+		if s.IsTotal() {
+			continue
+		}
 		if !ok {
 			changes = append(changes, model.Change{
-				CourseName: courseName,
+				CourseID:   course.ID,
+				CourseName: course.Name,
 				TP:         model.NewElement,
 				New:        s,
 			})
 		} else {
 			if !old.IsEqual(s) {
 				changes = append(changes, model.Change{
-					CourseName: courseName,
+					CourseID:   course.ID,
+					CourseName: course.Name,
 					TP:         model.Changed,
 					Old:        old,
 					New:        s,
@@ -216,5 +323,26 @@ func Compare(courseName string, old, new []*model.GradeRow) []model.Change {
 		}
 	}
 
+	for _, s := range old {
+		if !matched[s] && !s.IsTotal() {
+			changes = append(changes, model.Change{
+				CourseID:   course.ID,
+				CourseName: course.Name,
+				TP:         model.Removed,
+				Old:        s,
+			})
+		}
+	}
+
 	return changes
 }
+
+// rowKey identifies a row within its course snapshot. The root category is
+// named after the course and left out, so a renamed course keeps its keys.
+func rowKey(row *model.GradeRow) string {
+	_, path, ok := strings.Cut(row.Category, model.CategorySeparator)
+	if !ok {
+		return row.AssName
+	}
+	return path + model.CategorySeparator + row.AssName
+}
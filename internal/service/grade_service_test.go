@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	quiz := model.NewGradeRow([]string{"Quiz", "", "5.00", "0–10", "50.00 %"})
+	quizRegraded := model.NewGradeRow([]string{"Quiz", "", "7.00", "0–10", "70.00 %"})
+	midterm := model.NewGradeRow([]string{"Midterm", "", "40.00", "0–50", "80.00 %"})
+	final := model.NewGradeRow([]string{"Final", "", "-", "0–100", "-"})
+	total := model.NewGradeRow([]string{"Course total", "", "45.00", "0–60", "75.00 %", "", "", "", "", "", string(model.CourseTotalRow)})
+	totalRegraded := model.NewGradeRow([]string{"Course total", "", "47.00", "0–60", "78.33 %", "", "", "", "", "", string(model.CourseTotalRow)})
+	// Snapshots written before totals were told apart.
+	legacyTotal := model.NewGradeRow([]string{"Course total", "", "45.00", "0–60", "75.00 %"})
+	labQuiz := model.NewGradeRow([]string{"Quiz", "", "5.00", "0–10", "50.00 %", "", "", "", "", "", "", "course / Labs"})
+	labQuizRegraded := model.NewGradeRow([]string{"Quiz", "", "9.00", "0–10", "90.00 %", "", "", "", "", "", "", "course / Labs"})
+	homeworkQuiz := model.NewGradeRow([]string{"Quiz", "", "5.00", "0–10", "50.00 %", "", "", "", "", "", "", "course / Homework"})
+	renamedLabQuiz := model.NewGradeRow([]string{"Quiz", "", "5.00", "0–10", "50.00 %", "", "", "", "", "", "", "renamed / Labs"})
+
+	testcases := []struct {
+		name     string
+		old, new []*model.GradeRow
+		expected []model.Change
+	}{
+		{
+			name: "no changes",
+			old:  []*model.GradeRow{quiz, midterm},
+			new:  []*model.GradeRow{quiz, midterm},
+		},
+		{
+			name: "new and changed",
+			old:  []*model.GradeRow{quiz},
+			new:  []*model.GradeRow{quizRegraded, final},
+			expected: []model.Change{
+				{TP: model.Changed, CourseID: "1", CourseName: "course", Old: quiz, New: quizRegraded},
+				{TP: model.NewElement, CourseID: "1", CourseName: "course", New: final},
+			},
+		},
+		{
+			name: "removed",
+			old:  []*model.GradeRow{quiz, midterm},
+			new:  []*model.GradeRow{quiz},
+			expected: []model.Change{
+				{TP: model.Removed, CourseID: "1", CourseName: "course", Old: midterm},
+			},
+		},
+		{
+			name: "totals",
+			old:  []*model.GradeRow{quiz, total},
+			new:  []*model.GradeRow{quizRegraded, totalRegraded},
+			expected: []model.Change{
+				{TP: model.Changed, CourseID: "1", CourseName: "course", Old: quiz, New: quizRegraded},
+			},
+		},
+		{
+			name: "same name in different categories",
+			old:  []*model.GradeRow{labQuiz, homeworkQuiz},
+			new:  []*model.GradeRow{homeworkQuiz, labQuizRegraded},
+			expected: []model.Change{
+				{TP: model.Changed, CourseID: "1", CourseName: "course", Old: labQuiz, New: labQuizRegraded},
+			},
+		},
+		{
+			name: "new item with a taken name",
+			old:  []*model.GradeRow{labQuiz},
+			new:  []*model.GradeRow{labQuiz, homeworkQuiz},
+			expected: []model.Change{
+				{TP: model.NewElement, CourseID: "1", CourseName: "course", New: homeworkQuiz},
+			},
+		},
+		{
+			name: "renamed course",
+			old:  []*model.GradeRow{labQuiz, homeworkQuiz},
+			new:  []*model.GradeRow{renamedLabQuiz, homeworkQuiz},
+		},
+		{
+			name: "legacy rows without a category",
+			old:  []*model.GradeRow{quiz, midterm},
+			new:  []*model.GradeRow{labQuizRegraded, homeworkQuiz},
+			expected: []model.Change{
+				{TP: model.Changed, CourseID: "1", CourseName: "course", Old: quiz, New: labQuizRegraded},
+				{TP: model.NewElement, CourseID: "1", CourseName: "course", New: homeworkQuiz},
+				{TP: model.Removed, CourseID: "1", CourseName: "course", Old: midterm},
+			},
+		},
+		{
+			name: "legacy total",
+			old:  []*model.GradeRow{quiz, legacyTotal},
+			new:  []*model.GradeRow{quiz, totalRegraded},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, Compare(model.Course{ID: "1", Name: "course"}, tc.old, tc.new))
+		})
+	}
+}
+
+func TestGradeService_Close(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewCSVStorage(filepath.Join(dir, "courses"), filepath.Join(dir, "history"))
+	require.NoError(t, err)
+	svc := NewGradeService(nil, store, 1)
+
+	// A running sync holds Close back.
+	require.True(t, svc.isRunning.CompareAndSwap(false, true))
+	closed := make(chan error)
+	go func() { closed <- svc.Close() }()
+
+	select {
+	case <-closed:
+		t.Fatal("Close did not wait for the running sync")
+	case <-time.After(150 * time.Millisecond):
+	}
+	svc.isRunning.Store(false)
+	require.NoError(t, <-closed)
+
+	_, err = svc.ParseAndCompare(context.Background())
+	assert.ErrorIs(t, err, ErrClosed)
+	assert.NoError(t, svc.Close(), "closing twice")
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"log/slog"
+	"slices"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+)
+
+func (p *GradeService) appendHistory(events []model.GradeEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	slog.Debug("appendHistory", "events", len(events))
+
+	records := make([][]string, 0, len(events))
+	for _, ev := range events {
+		records = append(records, ev.ToStringSlice())
+	}
+
+	return p.store.AppendHistory(records)
+}
+
+// GetHistory returns every recorded event of the course FindCourse resolves
+// courseQuery to, oldest first. Events are matched by course ID, so they
+// survive renames; events recorded before courses had IDs are matched by
+// the current name.
+func (p *GradeService) GetHistory(courseQuery string) (model.Course, []model.GradeEvent, error) {
+	slog.Debug("GetHistory", "course", courseQuery)
+
+	course, err := p.FindCourse(courseQuery)
+	if err != nil {
+		return model.Course{}, nil, err
+	}
+
+	records, err := p.store.ReadHistory()
+	if err != nil {
+		return model.Course{}, nil, err
+	}
+
+	var events []model.GradeEvent
+	for _, record := range records {
+		ev, err := model.ParseGradeEvent(record)
+		if err != nil {
+			slog.Warn("Skipping malformed history record", "record", record, "error", err)
+			continue
+		}
+		if ev.CourseID == course.ID || ev.CourseID == "" && ev.CourseName == course.Name {
+			events = append(events, ev)
+		}
+	}
+
+	slices.SortStableFunc(events, func(a, b model.GradeEvent) int {
+		return a.ObservedAt.Compare(b.ObservedAt)
+	})
+
+	return course, events, nil
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"net/http"
+
+	"golang.org/x/time/rate"
+)
+
+// NewRateLimiter returns the token bucket shared by every request to Moodle.
+// A non-positive rate disables limiting.
+func NewRateLimiter(perSecond float64, burst int) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), max(burst, 1))
+}
+
+// rateLimitedTransport waits for a token before every request, including
+// each redirect and retry.
+type rateLimitedTransport struct {
+	limiter *rate.Limiter
+	next    http.RoundTripper
+}
+
+func newRateLimitedTransport(limiter *rate.Limiter, next http.RoundTripper) http.RoundTripper {
+	if limiter == nil {
+		return next
+	}
+	return &rateLimitedTransport{
+		limiter: limiter,
+		next:    next,
+	}
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitedTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: newRateLimitedTransport(NewRateLimiter(20, 1), http.DefaultTransport)}
+
+	start := time.Now()
+	for range 3 {
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	// The first request uses the burst, the other two wait 50ms each.
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+}
+
+func TestNewRateLimiter_Disabled(t *testing.T) {
+	limiter := NewRateLimiter(0, 0)
+	for range 100 {
+		assert.True(t, limiter.Allow())
+	}
+}
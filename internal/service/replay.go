@@ -0,0 +1,244 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"golang.org/x/time/rate"
+)
+
+const redacted = "REDACTED"
+
+// secretParams never end up in a recording, neither in the file names nor in
+// the saved URLs.
+var secretParams = []string{"username", "password", "wstoken", "token", "logintoken", "sesskey"}
+
+// sessionValuePattern matches the session key Moodle embeds in links and JS
+// config, and the tokens returned by login/token.php.
+var sessionValuePattern = regexp.MustCompile(`("?(?:sesskey|token|privatetoken)"?\s*[=:]\s*"?)[A-Za-z0-9]+`)
+
+// newMoodleTransport is the transport of every Moodle client: recordings from
+// disk in replay mode, otherwise the network behind the rate limiter,
+// optionally recorded.
+func newMoodleTransport(cfg config.MoodleConfig, limiter *rate.Limiter) http.RoundTripper {
+	if cfg.MoodleReplayDir != "" {
+		return newReplayTransport(cfg.MoodleReplayDir)
+	}
+
+	next := http.DefaultTransport
+	if cfg.MoodleRecordDir != "" {
+		next = newRecordingTransport(cfg.MoodleRecordDir, next, cfg.MoodleUser, cfg.MoodlePass, cfg.MoodleToken)
+	}
+	return newRateLimitedTransport(limiter, next)
+}
+
+// recordedResponse is the metadata saved next to a recorded body.
+type recordedResponse struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+}
+
+// recordingTransport saves every response it passes through to dir, with
+// cookies, credentials and session keys redacted, so it can be replayed by
+// replayTransport.
+type recordingTransport struct {
+	dir     string
+	next    http.RoundTripper
+	secrets []string
+}
+
+func newRecordingTransport(dir string, next http.RoundTripper, secrets ...string) *recordingTransport {
+	return &recordingTransport{
+		dir:  dir,
+		next: next,
+		// Very short values would redact half of every page.
+		secrets: slices.DeleteFunc(slices.Clone(secrets), func(s string) bool { return len(s) < 4 }),
+	}
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := recordingKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	if err := t.save(key, req, resp, body); err != nil {
+		slog.Warn("Failed to record Moodle response", "url", t.redact(req.URL.String()), "error", err)
+	}
+	return resp, nil
+}
+
+func (t *recordingTransport) save(key string, req *http.Request, resp *http.Response, body []byte) error {
+	header := resp.Header.Clone()
+	if cookies := header.Values("Set-Cookie"); len(cookies) > 0 {
+		header.Del("Set-Cookie")
+		for _, c := range cookies {
+			name, _, _ := strings.Cut(c, "=")
+			header.Add("Set-Cookie", name+"="+redacted+"; Path=/")
+		}
+	}
+	for k, values := range header {
+		for i, v := range values {
+			values[i] = t.redact(v)
+		}
+		header[k] = values
+	}
+
+	meta, err := json.MarshalIndent(recordedResponse{
+		Method: req.Method,
+		URL:    t.redact(redactURL(req.URL).String()),
+		Status: resp.StatusCode,
+		Header: header,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(t.dir, recordingName(key))
+	if err := os.WriteFile(name+".json", meta, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(name+".body", []byte(t.redact(string(body))), 0644)
+}
+
+func (t *recordingTransport) redact(s string) string {
+	for _, secret := range t.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return sessionValuePattern.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// replayTransport answers requests from a directory written by
+// recordingTransport, without touching the network.
+type replayTransport struct {
+	dir string
+}
+
+func newReplayTransport(dir string) *replayTransport {
+	return &replayTransport{dir: dir}
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key, err := recordingKey(req)
+	if err != nil {
+		return nil, err
+	}
+
+	name := filepath.Join(t.dir, recordingName(key))
+	buf, err := os.ReadFile(name + ".json")
+	if err != nil {
+		return nil, fmt.Errorf("no recording for %s: %w", key, err)
+	}
+	var meta recordedResponse
+	if err := json.Unmarshal(buf, &meta); err != nil {
+		return nil, fmt.Errorf("corrupted recording %s: %v", name, err)
+	}
+	body, err := os.ReadFile(name + ".body")
+	if err != nil {
+		return nil, fmt.Errorf("no recording for %s: %w", key, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", meta.Status, http.StatusText(meta.Status)),
+		StatusCode:    meta.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        meta.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// recordingKey identifies a request without its secrets: method, URL and,
+// for form posts, the form fields.
+func recordingKey(req *http.Request) (string, error) {
+	key := req.Method + " " + redactURL(req.URL).String()
+
+	// GetBody gives a copy, a RoundTripper must not consume the request body.
+	if req.GetBody == nil {
+		return key, nil
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return "", err
+	}
+	body, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return "", err
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return key, nil
+	}
+	for _, p := range secretParams {
+		form.Del(p)
+	}
+	if len(form) > 0 {
+		key += " " + form.Encode()
+	}
+	return key, nil
+}
+
+func redactURL(u *url.URL) *url.URL {
+	out := *u
+	q := out.Query()
+	for _, p := range secretParams {
+		if q.Has(p) {
+			q.Set(p, redacted)
+		}
+	}
+	out.RawQuery = q.Encode()
+	return &out
+}
+
+var unsafeNameChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// recordingName turns a key into a readable file name, e.g.
+// get_course_user_php_id_123_mode_grade_user_2-1a2b3c4d.
+func recordingName(key string) string {
+	method, rest, _ := strings.Cut(key, " ")
+	if u, err := url.Parse(strings.Fields(rest)[0]); err == nil {
+		rest = strings.TrimPrefix(key, method+" "+u.Scheme+"://"+u.Host)
+	}
+
+	slug := strings.Trim(unsafeNameChars.ReplaceAllString(strings.ToLower(method+" "+rest), "_"), "_")
+	if len(slug) > 80 {
+		slug = slug[:80]
+	}
+	sum := sha256.Sum256([]byte(key))
+	return slug + "-" + hex.EncodeToString(sum[:4])
+}
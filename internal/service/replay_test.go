@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/moodletest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	srv := moodletest.New(t, "student", "secret-pass", fakeCourses...)
+	dir := t.TempDir()
+
+	cfg := srv.MoodleConfig()
+	cfg.MoodleRecordDir = dir
+	recorded := newTestService(t, cfg)
+	_, err := recorded.ParseAndCompare(context.Background())
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+	for _, f := range files {
+		buf, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		require.NoError(t, err)
+		assert.NotContains(t, string(buf), "secret-pass", f.Name())
+		if strings.HasSuffix(f.Name(), ".json") && strings.Contains(string(buf), "Set-Cookie") {
+			assert.Contains(t, string(buf), "MoodleSession="+redacted, f.Name())
+		}
+	}
+
+	// Moodle is gone, the replayed sync sees the same grades.
+	srv.Close()
+	cfg.MoodleRecordDir = ""
+	cfg.MoodleReplayDir = dir
+	replayed := newTestService(t, cfg)
+	_, err = replayed.ParseAndCompare(context.Background())
+	require.NoError(t, err)
+
+	rows, err := replayed.GetCourseGrades("101")
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "Quiz 1", rows[0].AssName)
+	assert.Equal(t, "8.00", rows[0].Score)
+}
+
+func TestRecordingTransport_Redact(t *testing.T) {
+	rt := newRecordingTransport(t.TempDir(), nil, "student", "hunter22")
+	assert.Equal(t, `<a href="/login/logout.php?sesskey=REDACTED">REDACTED</a>`,
+		rt.redact(`<a href="/login/logout.php?sesskey=Ab12Cd34">student</a>`))
+	assert.Equal(t, `{"token":"REDACTED","privatetoken":"REDACTED"}`,
+		rt.redact(`{"token":"0123abcd","privatetoken":"xyz987"}`))
+}
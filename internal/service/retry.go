@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxRetryAfter bounds how long a Retry-After header may make us wait; a
+// server asking for more is treated as down.
+const maxRetryAfter = 5 * time.Minute
+
+type FetchErrorKind string
+
+const (
+	KindNetwork     FetchErrorKind = "network"
+	KindServer      FetchErrorKind = "server"
+	KindRateLimited FetchErrorKind = "rate_limited"
+	KindClient      FetchErrorKind = "client"
+)
+
+// FetchError is the final error of a request after all retries.
+type FetchError struct {
+	Kind       FetchErrorKind
+	URL        string
+	Attempts   int
+	StatusCode int
+	Err        error
+}
+
+func (e *FetchError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("%s error fetching %s after %d attempt(s): status %d", e.Kind, e.URL, e.Attempts, e.StatusCode)
+	}
+	return fmt.Sprintf("%s error fetching %s after %d attempt(s): %v", e.Kind, e.URL, e.Attempts, e.Err)
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether the request may succeed if tried again later.
+func (e *FetchError) Transient() bool {
+	return e.Kind != KindClient
+}
+
+// RetryPolicy is an exponential backoff with jitter for transient failures:
+// network errors, 429 and 5xx responses.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// backoff returns the delay before the given retry (1 is the first retry):
+// half of the exponential delay plus a random part of the other half.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.BaseDelay << (retry - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + rand.N(half)
+}
+
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(h); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+func classifyStatus(code int) (FetchErrorKind, bool) {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return KindRateLimited, true
+	case code >= 500:
+		return KindServer, true
+	case code >= 400:
+		return KindClient, true
+	}
+	return "", false
+}
+
+// isTransientNetErr tells temporary network failures from errors such as an
+// invalid URL or too many redirects.
+func isTransientNetErr(err error) bool {
+	var netErr net.Error
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &opErr), errors.As(err, &dnsErr):
+		return true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return true
+	}
+	return false
+}
+
+// Do performs the request built by newReq, retrying transient failures. A
+// successful response (status below 400) is returned as is; otherwise the
+// result is a *FetchError. When ctx is done the context error is returned
+// without further attempts.
+func (p RetryPolicy) Do(ctx context.Context, client *http.Client, newReq func() (*http.Request, error)) (*http.Response, error) {
+	attempts := max(p.MaxAttempts, 1)
+
+	var lastErr *FetchError
+	for attempt := 1; attempt <= attempts; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+
+		var wait time.Duration
+		resp, err := client.Do(req.WithContext(ctx))
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return nil, fmt.Errorf("request to %s aborted: %w", req.URL, ctx.Err())
+		case err != nil:
+			lastErr = &FetchError{Kind: KindNetwork, URL: req.URL.String(), Attempts: attempt, Err: err}
+			if !isTransientNetErr(err) {
+				lastErr.Kind = KindClient
+				return nil, lastErr
+			}
+		default:
+			kind, failed := classifyStatus(resp.StatusCode)
+			if !failed {
+				return resp, nil
+			}
+			lastErr = &FetchError{Kind: kind, URL: req.URL.String(), Attempts: attempt, StatusCode: resp.StatusCode, Err: errors.New(resp.Status)}
+			if d, ok := retryAfter(resp); ok {
+				wait = d
+			}
+			resp.Body.Close()
+			if kind == KindClient {
+				return nil, lastErr
+			}
+		}
+
+		if attempt == attempts {
+			break
+		}
+		if wait > maxRetryAfter {
+			slog.Warn("Retry-After too long, giving up", "url", lastErr.URL, "retry_after", wait)
+			break
+		}
+		wait = max(wait, p.backoff(attempt))
+
+		slog.Warn("Moodle request failed, retrying",
+			"url", lastErr.URL,
+			"attempt", attempt,
+			"max_attempts", attempts,
+			"kind", lastErr.Kind,
+			"error", lastErr.Err,
+			"delay", wait)
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("request to %s aborted: %w", lastErr.URL, ctx.Err())
+		case <-t.C:
+		}
+	}
+
+	return nil, lastErr
+}
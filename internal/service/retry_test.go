@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicy_Do(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	testcases := []struct {
+		name         string
+		statuses     []int
+		retryAfter   string
+		expectedErr  FetchErrorKind
+		expectedHits int32
+	}{
+		{name: "ok", statuses: []int{200}, expectedHits: 1},
+		{name: "recovers from 5xx", statuses: []int{502, 503, 200}, expectedHits: 3},
+		{name: "gives up on 5xx", statuses: []int{503, 503, 503}, expectedErr: KindServer, expectedHits: 3},
+		{name: "no retry on 4xx", statuses: []int{404, 200}, expectedErr: KindClient, expectedHits: 1},
+		{name: "honours retry-after", statuses: []int{429, 200}, retryAfter: "0", expectedHits: 2},
+		{name: "too long retry-after", statuses: []int{429, 200}, retryAfter: "3600", expectedErr: KindRateLimited, expectedHits: 1},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := hits.Add(1)
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(tc.statuses[n-1])
+			}))
+			defer srv.Close()
+
+			resp, err := policy.Do(context.Background(), srv.Client(), func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL, nil)
+			})
+			assert.Equal(t, tc.expectedHits, hits.Load())
+
+			if tc.expectedErr == "" {
+				require.NoError(t, err)
+				resp.Body.Close()
+				return
+			}
+
+			var fetchErr *FetchError
+			require.ErrorAs(t, err, &fetchErr)
+			assert.Equal(t, tc.expectedErr, fetchErr.Kind)
+			assert.Equal(t, int(tc.expectedHits), fetchErr.Attempts)
+		})
+	}
+}
+
+func TestRetryPolicy_Do_ContextDone(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour}
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := policy.Do(ctx, srv.Client(), func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, srv.URL, nil)
+	})
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(1), hits.Load())
+}
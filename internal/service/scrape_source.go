@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+)
+
+// ScrapeSource reads grades by scraping the Moodle HTML pages after a form login.
+type ScrapeSource struct {
+	fetcher   *MoodleFetcher
+	badTitles []string
+}
+
+func NewScrapeSource(fetcher *MoodleFetcher, badTitles []string) *ScrapeSource {
+	return &ScrapeSource{
+		fetcher:   fetcher,
+		badTitles: badTitles,
+	}
+}
+
+func (s *ScrapeSource) Courses(ctx context.Context) ([]model.Course, error) {
+	if err := s.fetcher.IsLogined(ctx); err != nil {
+		err = s.fetcher.Login(ctx)
+		if err != nil {
+			slog.Error("Login failed", "error", err)
+		}
+	}
+
+	buf, err := s.fetcher.GetGradesPage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return extractGradesLinks(buf, s.badTitles)
+}
+
+func (s *ScrapeSource) CourseGrades(ctx context.Context, course model.Course) (string, []*model.GradeRow, error) {
+	buf, err := s.fetcher.Fetch(ctx, course.URL)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return extractItems(buf)
+}
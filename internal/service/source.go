@@ -0,0 +1,14 @@
+package service
+
+import (
+	"context"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+)
+
+// GradeSource is where GradeService gets its data from: the list of courses
+// and the grade items of each course.
+type GradeSource interface {
+	Courses(ctx context.Context) ([]model.Course, error)
+	CourseGrades(ctx context.Context, course model.Course) (courseName string, rows []*model.GradeRow, err error)
+}
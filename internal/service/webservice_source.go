@@ -0,0 +1,314 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"golang.org/x/time/rate"
+)
+
+var ErrWebService = errors.New("❗️ moodle web service error")
+
+// WebServiceSource reads grades through the official Moodle Web Services REST
+// API (webservice/rest/server.php) using a user token.
+type WebServiceSource struct {
+	client   *http.Client
+	retry    RetryPolicy
+	endpoint string
+	token    string
+
+	// userID is looked up once; a failed lookup is retried on the next call.
+	userMux sync.Mutex
+	userID  int
+
+	badTitles []string
+}
+
+func NewWebServiceSource(cfg config.MoodleConfig, limiter *rate.Limiter, badTitles []string) *WebServiceSource {
+	return &WebServiceSource{
+		client: &http.Client{
+			Transport: newMoodleTransport(cfg, limiter),
+			Timeout:   cfg.MoodleRequestTimeout,
+		},
+		retry: RetryPolicy{
+			MaxAttempts: cfg.MoodleRetryMaxAttempts,
+			BaseDelay:   cfg.MoodleRetryBaseDelay,
+			MaxDelay:    cfg.MoodleRetryMaxDelay,
+		},
+		endpoint:  cfg.MoodleWebServiceURL,
+		token:     cfg.MoodleToken,
+		badTitles: badTitles,
+	}
+}
+
+type wsException struct {
+	Exception string `json:"exception"`
+	ErrorCode string `json:"errorcode"`
+	Message   string `json:"message"`
+}
+
+type wsCourse struct {
+	ID        int    `json:"id"`
+	ShortName string `json:"shortname"`
+	FullName  string `json:"fullname"`
+}
+
+type wsGradeItem struct {
+	ItemName             *string `json:"itemname"`
+	ItemType             string  `json:"itemtype"`
+	ItemInstance         int     `json:"iteminstance"`
+	CategoryID           *int    `json:"categoryid"`
+	WeightFormatted      string  `json:"weightformatted"`
+	GradeFormatted       string  `json:"gradeformatted"`
+	RangeFormatted       string  `json:"rangeformatted"`
+	PercentageFormatted  string  `json:"percentageformatted"`
+	Feedback             string  `json:"feedback"`
+	LetterGradeFormatted string  `json:"lettergradeformatted"`
+	AverageFormatted     string  `json:"averageformatted"`
+}
+
+type wsUserGrades struct {
+	UserGrades []struct {
+		CourseID   int           `json:"courseid"`
+		GradeItems []wsGradeItem `json:"gradeitems"`
+	} `json:"usergrades"`
+}
+
+func (s *WebServiceSource) call(ctx context.Context, function string, params url.Values, out any) error {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("wstoken", s.token)
+	params.Set("wsfunction", function)
+	params.Set("moodlewsrestformat", "json")
+
+	// All functions used here only read data, so retrying the POST is safe.
+	resp, err := s.retry.Do(ctx, s.client, func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, s.endpoint, strings.NewReader(params.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("error calling %s: %w", function, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status: %s", function, resp.Status)
+	}
+
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(resp.Body); err != nil {
+		return fmt.Errorf("failed to read %s response: %v", function, err)
+	}
+
+	// Moodle reports errors with status 200 and an exception object in the body.
+	var exc wsException
+	if json.Unmarshal(buf.Bytes(), &exc) == nil && exc.Exception != "" {
+		return fmt.Errorf("%w: %s: %s (%s)", ErrWebService, function, exc.Message, exc.ErrorCode)
+	}
+
+	if err := json.Unmarshal(buf.Bytes(), out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %v", function, err)
+	}
+	return nil
+}
+
+func (s *WebServiceSource) currentUserID(ctx context.Context) (int, error) {
+	s.userMux.Lock()
+	defer s.userMux.Unlock()
+
+	if s.userID != 0 {
+		return s.userID, nil
+	}
+
+	var info struct {
+		UserID int `json:"userid"`
+	}
+	if err := s.call(ctx, "core_webservice_get_site_info", nil, &info); err != nil {
+		return 0, err
+	}
+	s.userID = info.UserID
+	return s.userID, nil
+}
+
+func (s *WebServiceSource) Courses(ctx context.Context) ([]model.Course, error) {
+	userID, err := s.currentUserID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var wsCourses []wsCourse
+	err = s.call(ctx, "core_enrol_get_users_courses", url.Values{
+		"userid": {strconv.Itoa(userID)},
+	}, &wsCourses)
+	if err != nil {
+		return nil, err
+	}
+
+	var courses []model.Course
+	for _, c := range wsCourses {
+		if slices.Contains(s.badTitles, c.FullName) {
+			continue
+		}
+		courses = append(courses, model.Course{
+			ID:   strconv.Itoa(c.ID),
+			Name: c.FullName,
+		})
+	}
+
+	return courses, nil
+}
+
+func (s *WebServiceSource) CourseGrades(ctx context.Context, course model.Course) (string, []*model.GradeRow, error) {
+	userID, err := s.currentUserID(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var report wsUserGrades
+	err = s.call(ctx, "gradereport_user_get_grade_items", url.Values{
+		"courseid": {course.ID},
+		"userid":   {strconv.Itoa(userID)},
+	}, &report)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if len(report.UserGrades) == 0 {
+		return "", nil, fmt.Errorf("no grades returned for course %s", course.ID)
+	}
+
+	items := report.UserGrades[0].GradeItems
+
+	// The course total's instance is the top category. The report has no
+	// names or nesting of other categories, so they are taken as direct
+	// children of it.
+	rootID := -1
+	for _, item := range items {
+		if item.ItemType == "course" {
+			rootID = item.ItemInstance
+		}
+	}
+	categoryPath := func(id int) string {
+		if id == rootID {
+			return course.Name
+		}
+		return course.Name + model.CategorySeparator + "Category " + strconv.Itoa(id)
+	}
+
+	var rows []*model.GradeRow
+	for _, item := range items {
+		raw := make([]string, model.NumColumns)
+		switch {
+		case item.ItemType == "course":
+			raw[model.ColName] = "Course total"
+			raw[model.ColKind] = string(model.CourseTotalRow)
+			raw[model.ColCategory] = course.Name
+		case item.ItemType == "category":
+			raw[model.ColName] = "Category total"
+			raw[model.ColKind] = string(model.CategoryTotalRow)
+			raw[model.ColCategory] = categoryPath(item.ItemInstance)
+		case item.ItemName == nil:
+			continue
+		default:
+			raw[model.ColName] = trim(*item.ItemName)
+			if item.CategoryID != nil {
+				raw[model.ColCategory] = categoryPath(*item.CategoryID)
+			}
+		}
+		if item.ItemName != nil && *item.ItemName != "" {
+			raw[model.ColName] = trim(*item.ItemName)
+		}
+
+		raw[model.ColWeight] = wsText(item.WeightFormatted)
+		raw[model.ColScore] = wsText(item.GradeFormatted)
+		raw[model.ColRange] = wsText(item.RangeFormatted)
+		raw[model.ColPercentage] = wsText(item.PercentageFormatted)
+		raw[model.ColFeedback] = wsText(item.Feedback)
+		raw[model.ColLetterGrade] = wsText(item.LetterGradeFormatted)
+		raw[model.ColAverage] = wsText(item.AverageFormatted)
+		rows = append(rows, model.NewGradeRow(raw))
+	}
+
+	return course.Name, rows, nil
+}
+
+// wsText turns the HTML fragments returned by the web service into plain text.
+func wsText(s string) string {
+	if !strings.Contains(s, "<") {
+		return trim(html.UnescapeString(s))
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(s))
+	if err != nil {
+		return trim(html.UnescapeString(s))
+	}
+	return trim(doc.Text())
+}
+
+// RequestWebServiceToken exchanges Moodle credentials for a mobile app web
+// service token via login/token.php next to the configured REST endpoint. The
+// request waits on limiter like every other call to Moodle.
+func RequestWebServiceToken(ctx context.Context, cfg config.MoodleConfig, limiter *rate.Limiter, user, pass string) (string, error) {
+	tokenURL, err := url.Parse(cfg.MoodleWebServiceURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid web service url: %v", err)
+	}
+	tokenURL.Path = strings.TrimSuffix(tokenURL.Path, "/webservice/rest/server.php") + "/login/token.php"
+	tokenURL.RawQuery = ""
+
+	form := url.Values{
+		"username": {user},
+		"password": {pass},
+		"service":  {"moodle_mobile_app"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL.String(), strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{
+		Transport: newMoodleTransport(cfg, limiter),
+		Timeout:   cfg.MoodleRequestTimeout,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error requesting token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Token     string `json:"token"`
+		Error     string `json:"error"`
+		ErrorCode string `json:"errorcode"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("failed to decode token response: %v", err)
+	}
+
+	if out.ErrorCode == "invalidlogin" {
+		return "", ErrWrongCredentials
+	}
+	if out.Token == "" {
+		return "", fmt.Errorf("%w: %s (%s)", ErrWebService, out.Error, out.ErrorCode)
+	}
+	return out.Token, nil
+}
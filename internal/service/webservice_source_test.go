@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+const wsSiteInfo = `{"userid": 42, "username": "student"}`
+
+// newWebServiceSource serves the given JSON body for every web service
+// function and checks the token and user id sent with each call.
+func newWebServiceSource(t *testing.T, responses map[string]string) *WebServiceSource {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webservice/rest/server.php", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "token", r.PostForm.Get("wstoken"))
+		assert.Equal(t, "json", r.PostForm.Get("moodlewsrestformat"))
+		if userID := r.PostForm.Get("userid"); userID != "" {
+			assert.Equal(t, "42", userID)
+		}
+
+		body, ok := responses[r.PostForm.Get("wsfunction")]
+		if !ok {
+			body = `{"exception": "dml_missing_record_exception", "errorcode": "invalidrecord", "message": "Can't find data record in database table external_functions."}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return NewWebServiceSource(wsConfig(srv.URL), nil, []string{"Sandbox course"})
+}
+
+func wsConfig(url string) config.MoodleConfig {
+	return config.MoodleConfig{
+		MoodleWebServiceURL:    url + "/webservice/rest/server.php",
+		MoodleToken:            "token",
+		MoodleRetryMaxAttempts: 1,
+		MoodleRequestTimeout:   time.Second,
+	}
+}
+
+func TestWebServiceSource_Courses(t *testing.T) {
+	source := newWebServiceSource(t, map[string]string{
+		"core_webservice_get_site_info": wsSiteInfo,
+		"core_enrol_get_users_courses": `[
+			{"id": 101, "shortname": "CALC2", "fullname": "Calculus II"},
+			{"id": 7, "shortname": "SBX", "fullname": "Sandbox course"},
+			{"id": 202, "shortname": "DM", "fullname": "Discrete Mathematics"}
+		]`,
+	})
+
+	courses, err := source.Courses(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []model.Course{
+		{ID: "101", Name: "Calculus II"},
+		{ID: "202", Name: "Discrete Mathematics"},
+	}, courses)
+}
+
+func TestWebServiceSource_CourseGrades(t *testing.T) {
+	testcases := []struct {
+		name     string
+		items    string
+		expected []*model.GradeRow
+	}{
+		{
+			// Without the course total the root category is unknown.
+			name: "items",
+			items: `[
+				{"itemname": "Quiz 1", "itemtype": "mod", "iteminstance": 5, "categoryid": 1,
+				 "weightformatted": "10.00 %", "gradeformatted": "8.00", "rangeformatted": "0&ndash;10",
+				 "percentageformatted": "80.00 %", "feedback": "<p>Good <b>job</b></p>",
+				 "lettergradeformatted": "B", "averageformatted": "7.10"},
+				{"itemname": "Final", "itemtype": "mod", "iteminstance": 6, "categoryid": 1,
+				 "weightformatted": "90.00 %", "gradeformatted": "-", "rangeformatted": "0&ndash;100",
+				 "percentageformatted": "-"},
+				{"itemname": null, "itemtype": "mod", "iteminstance": 7, "categoryid": 1}
+			]`,
+			expected: []*model.GradeRow{
+				model.NewGradeRow([]string{"Quiz 1", "10.00 %", "8.00", "0–10", "80.00 %", "Good job", "", "B", "", "7.10", "", "Calculus II / Category 1"}),
+				model.NewGradeRow([]string{"Final", "90.00 %", "-", "0–100", "-", "", "", "", "", "", "", "Calculus II / Category 1"}),
+			},
+		},
+		{
+			name: "totals and categories",
+			items: `[
+				{"itemname": "Quiz 1", "itemtype": "mod", "iteminstance": 4, "categoryid": 1,
+				 "weightformatted": "60.00 %", "gradeformatted": "4.00", "rangeformatted": "0&ndash;10", "percentageformatted": "40.00 %"},
+				{"itemname": "Lab 1", "itemtype": "mod", "iteminstance": 5, "categoryid": 3,
+				 "weightformatted": "50.00 %", "gradeformatted": "9.00", "rangeformatted": "0&ndash;10", "percentageformatted": "90.00 %"},
+				{"itemname": "", "itemtype": "category", "iteminstance": 3,
+				 "weightformatted": "40.00 %", "gradeformatted": "9.00", "rangeformatted": "0&ndash;10", "percentageformatted": "90.00 %"},
+				{"itemname": "Labs total", "itemtype": "category", "iteminstance": 4,
+				 "weightformatted": "", "gradeformatted": "-", "rangeformatted": "0&ndash;10", "percentageformatted": "-"},
+				{"itemname": null, "itemtype": "course", "iteminstance": 1,
+				 "gradeformatted": "36.00", "rangeformatted": "0&ndash;100", "percentageformatted": "36.00 %"}
+			]`,
+			expected: []*model.GradeRow{
+				model.NewGradeRow([]string{"Quiz 1", "60.00 %", "4.00", "0–10", "40.00 %", "", "", "", "", "", "", "Calculus II"}),
+				model.NewGradeRow([]string{"Lab 1", "50.00 %", "9.00", "0–10", "90.00 %", "", "", "", "", "", "", "Calculus II / Category 3"}),
+				model.NewGradeRow([]string{"Category total", "40.00 %", "9.00", "0–10", "90.00 %", "", "", "", "", "", "category", "Calculus II / Category 3"}),
+				model.NewGradeRow([]string{"Labs total", "", "-", "0–10", "-", "", "", "", "", "", "category", "Calculus II / Category 4"}),
+				model.NewGradeRow([]string{"Course total", "", "36.00", "0–100", "36.00 %", "", "", "", "", "", "course", "Calculus II"}),
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := newWebServiceSource(t, map[string]string{
+				"core_webservice_get_site_info":    wsSiteInfo,
+				"gradereport_user_get_grade_items": `{"usergrades": [{"courseid": 101, "gradeitems": ` + tc.items + `}]}`,
+			})
+
+			name, rows, err := source.CourseGrades(context.Background(), model.Course{ID: "101", Name: "Calculus II"})
+			require.NoError(t, err)
+			assert.Equal(t, "Calculus II", name)
+			assert.Equal(t, tc.expected, rows)
+		})
+	}
+}
+
+func TestWebServiceSource_Errors(t *testing.T) {
+	testcases := []struct {
+		name      string
+		responses map[string]string
+		err       string
+	}{
+		{
+			name:      "invalid token",
+			responses: map[string]string{"core_webservice_get_site_info": `{"exception": "moodle_exception", "errorcode": "invalidtoken", "message": "Invalid token - token not found"}`},
+			err:       "❗️ moodle web service error: core_webservice_get_site_info: Invalid token - token not found (invalidtoken)",
+		},
+		{
+			name: "function not enabled",
+			responses: map[string]string{
+				"core_webservice_get_site_info": wsSiteInfo,
+			},
+			err: "❗️ moodle web service error: gradereport_user_get_grade_items: Can't find data record in database table external_functions. (invalidrecord)",
+		},
+		{
+			name: "no grades",
+			responses: map[string]string{
+				"core_webservice_get_site_info":    wsSiteInfo,
+				"gradereport_user_get_grade_items": `{"usergrades": []}`,
+			},
+			err: "no grades returned for course 101",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			source := newWebServiceSource(t, tc.responses)
+
+			_, _, err := source.CourseGrades(context.Background(), model.Course{ID: "101", Name: "Calculus II"})
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestRequestWebServiceToken(t *testing.T) {
+	testcases := []struct {
+		name     string
+		user     string
+		response string
+		expected string
+		err      error
+		errText  string
+	}{
+		{name: "token", user: "student", response: `{"token": "abc123", "privatetoken": null}`, expected: "abc123"},
+		{name: "wrong credentials", user: "student", response: `{"error": "Invalid login, please try again", "errorcode": "invalidlogin"}`, err: ErrWrongCredentials},
+		{
+			name:     "service disabled",
+			user:     "student",
+			response: `{"error": "Web services must be enabled in Advanced features.", "errorcode": "enablewsdescription"}`,
+			err:      ErrWebService,
+			errText:  "❗️ moodle web service error: Web services must be enabled in Advanced features. (enablewsdescription)",
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/login/token.php", func(w http.ResponseWriter, r *http.Request) {
+				require.NoError(t, r.ParseForm())
+				assert.Equal(t, tc.user, r.PostForm.Get("username"))
+				assert.Equal(t, "secret", r.PostForm.Get("password"))
+				assert.Equal(t, "moodle_mobile_app", r.PostForm.Get("service"))
+				w.Write([]byte(tc.response))
+			})
+			srv := httptest.NewServer(mux)
+			t.Cleanup(srv.Close)
+
+			limiter := rate.NewLimiter(rate.Every(time.Hour), 1)
+			token, err := RequestWebServiceToken(context.Background(), wsConfig(srv.URL), limiter, tc.user, "secret")
+			assert.Less(t, limiter.Tokens(), 1.0, "the token request waits on the shared limiter")
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				if tc.errText != "" {
+					assert.EqualError(t, err, tc.errText)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, token)
+		})
+	}
+}
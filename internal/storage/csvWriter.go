@@ -51,6 +51,30 @@ func (w *CSVwriter) Write(filename string, records [][]string) error {
 	return nil
 }
 
+func (w *CSVwriter) Append(filename string, records [][]string) error {
+	path := filepath.Join(w.dir, filename)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil && err != os.ErrExist {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Comma = w.comma
+	for _, record := range records {
+		err := writer.Write(record)
+		if err != nil {
+			slog.Error("error in csvwriting", "err", err)
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
 func (w *CSVwriter) Read(filename string) ([][]string, error) {
 	file, err := os.Open(filepath.Join(w.dir, filename))
 	if err != nil {
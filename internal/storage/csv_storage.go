@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	courseFileSuffix = "_grades.csv"
+	courseIndexFile  = "courses_index.csv"
+	historyFile      = "grade_history.csv"
+)
+
+// CSVStorage keeps one CSV file per course, named after the course ID, an
+// index with the course display names and an append-only history file.
+type CSVStorage struct {
+	indexMux sync.Mutex
+	courses  *CSVwriter
+	history  *CSVwriter
+}
+
+func NewCSVStorage(coursesDir, historyDir string) (*CSVStorage, error) {
+	courses := NewCSVWriter(coursesDir)
+	history := NewCSVWriter(historyDir)
+	if courses == nil || history == nil {
+		return nil, errors.New("failed to create csv storage directories")
+	}
+
+	return &CSVStorage{
+		courses: courses,
+		history: history,
+	}, nil
+}
+
+func (s *CSVStorage) WriteCourse(course CourseInfo, records [][]string) error {
+	if err := s.courses.Write(buildFilePath(course.ID), records); err != nil {
+		return err
+	}
+	return s.updateIndex(course)
+}
+
+func (s *CSVStorage) ReadCourse(id string) ([][]string, error) {
+	return s.courses.Read(buildFilePath(id))
+}
+
+// ListCourses returns the indexed courses followed by the files written
+// before courses were keyed by ID; for those the sanitized name is both the
+// ID and the name, which ReadCourse accepts since sanitizing is idempotent.
+func (s *CSVStorage) ListCourses() ([]CourseInfo, error) {
+	index, err := s.readIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.courses.ListFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	var courses []CourseInfo
+	indexed := map[string]bool{}
+	for _, course := range index {
+		indexed[buildFilePath(course.ID)] = true
+		courses = append(courses, course)
+	}
+
+	for _, file := range files {
+		if indexed[file] {
+			continue
+		}
+		if stem, ok := strings.CutSuffix(file, courseFileSuffix); ok {
+			courses = append(courses, CourseInfo{ID: stem, Name: stem})
+		}
+	}
+	return courses, nil
+}
+
+func (s *CSVStorage) MigrateCourse(course CourseInfo) (bool, error) {
+	legacyPath := buildFilePath(course.Name)
+	idPath := buildFilePath(course.ID)
+	if legacyPath == idPath {
+		return false, nil
+	}
+
+	legacy := filepath.Join(s.courses.dir, legacyPath)
+	if _, err := os.Stat(legacy); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	target := filepath.Join(s.courses.dir, idPath)
+	if _, err := os.Stat(target); err == nil {
+		slog.Warn("Both legacy and ID snapshots exist, keeping legacy file", "course", course.Name, "id", course.ID)
+		return false, nil
+	}
+
+	if err := os.Rename(legacy, target); err != nil {
+		return false, err
+	}
+	return true, s.updateIndex(course)
+}
+
+func (s *CSVStorage) readIndex() ([]CourseInfo, error) {
+	records, err := s.courses.Read(courseIndexFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var index []CourseInfo
+	for _, record := range records {
+		if len(record) < 2 {
+			continue
+		}
+		index = append(index, CourseInfo{ID: record[0], Name: record[1]})
+	}
+	return index, nil
+}
+
+func (s *CSVStorage) updateIndex(course CourseInfo) error {
+	s.indexMux.Lock()
+	defer s.indexMux.Unlock()
+
+	index, err := s.readIndex()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i := range index {
+		if index[i].ID == course.ID {
+			if index[i].Name == course.Name {
+				return nil
+			}
+			index[i].Name = course.Name
+			found = true
+		}
+	}
+	if !found {
+		index = append(index, course)
+	}
+
+	records := make([][]string, 0, len(index))
+	for _, c := range index {
+		records = append(records, []string{c.ID, c.Name})
+	}
+	return s.courses.Write(courseIndexFile, records)
+}
+
+func (s *CSVStorage) AppendHistory(records [][]string) error {
+	return s.history.Append(historyFile, records)
+}
+
+func (s *CSVStorage) ReadHistory() ([][]string, error) {
+	records, err := s.history.Read(historyFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return records, err
+}
+
+func (s *CSVStorage) Close() error {
+	return nil
+}
+
+func buildFilePath(courseName string) string {
+	path := sanitizeFilename(courseName) + courseFileSuffix
+	return path
+}
+
+func sanitizeFilename(name string) string {
+	// Replace common invalid filename characters with underscores
+	invalidChars := []string{" ", ":", "/", "\\", "*", "?", "\"", "<", ">", "|"}
+	for _, char := range invalidChars {
+		name = strings.ReplaceAll(name, char, "_")
+	}
+	// Trim whitespace and limit length to avoid issues
+	name = strings.TrimSpace(name)
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	slog.Debug("sanitizeFilename", "result", name)
+	return name
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// migrations are applied in order; the index+1 is the schema version.
+// Never edit an applied migration, append a new one instead.
+var migrations = []string{
+	`CREATE TABLE snapshots (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);
+	CREATE TABLE snapshot_rows (
+		course_id TEXT    NOT NULL REFERENCES snapshots(id) ON DELETE CASCADE,
+		position  INTEGER NOT NULL,
+		item      TEXT    NOT NULL,
+		record    TEXT    NOT NULL,
+		PRIMARY KEY (course_id, position)
+	);
+	CREATE TABLE grade_history (
+		id     INTEGER PRIMARY KEY AUTOINCREMENT,
+		record TEXT NOT NULL
+	);`,
+}
+
+// SQLiteStorage keeps snapshots and history in a single SQLite database.
+// Records are stored as JSON arrays so they can be queried with json_extract.
+type SQLiteStorage struct {
+	db *sql.DB
+}
+
+func NewSQLiteStorage(path string) (*SQLiteStorage, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %v", err)
+	}
+	// SQLite allows a single writer; one connection avoids SQLITE_BUSY between goroutines.
+	db.SetMaxOpenConns(1)
+
+	s := &SQLiteStorage{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SQLiteStorage) migrate() error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create migrations table: %v", err)
+	}
+
+	var version int
+	err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %v", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		slog.Info("Applying sqlite migration", "version", i+1)
+
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %v", i+1, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`,
+			i+1, time.Now().UTC().Format(time.RFC3339)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %v", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d failed: %v", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) WriteCourse(course CourseInfo, records [][]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO snapshots (id, name, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET name = excluded.name, updated_at = excluded.updated_at`,
+		course.ID, course.Name, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM snapshot_rows WHERE course_id = ?`, course.ID); err != nil {
+		return err
+	}
+
+	for i, record := range records {
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		item := ""
+		if len(record) > 0 {
+			item = record[0]
+		}
+		_, err = tx.Exec(`INSERT INTO snapshot_rows (course_id, position, item, record) VALUES (?, ?, ?, ?)`,
+			course.ID, i, item, string(encoded))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) ReadCourse(id string) ([][]string, error) {
+	var exists bool
+	err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM snapshots WHERE id = ?)`, id).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("course %q: %w", id, os.ErrNotExist)
+	}
+
+	rows, err := s.db.Query(`SELECT record FROM snapshot_rows WHERE course_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (s *SQLiteStorage) ListCourses() ([]CourseInfo, error) {
+	rows, err := s.db.Query(`SELECT id, name FROM snapshots ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courses []CourseInfo
+	for rows.Next() {
+		var course CourseInfo
+		if err := rows.Scan(&course.ID, &course.Name); err != nil {
+			return nil, err
+		}
+		courses = append(courses, course)
+	}
+	return courses, rows.Err()
+}
+
+// MigrateCourse has nothing to do: the SQLite backend was keyed by course ID
+// from the start.
+func (s *SQLiteStorage) MigrateCourse(course CourseInfo) (bool, error) {
+	return false, nil
+}
+
+func (s *SQLiteStorage) AppendHistory(records [][]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, record := range records {
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO grade_history (record) VALUES (?)`, string(encoded)); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStorage) ReadHistory() ([][]string, error) {
+	rows, err := s.db.Query(`SELECT record FROM grade_history ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	return scanRecords(rows)
+}
+
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+func scanRecords(rows *sql.Rows) ([][]string, error) {
+	defer rows.Close()
+
+	var records [][]string
+	for rows.Next() {
+		var encoded string
+		if err := rows.Scan(&encoded); err != nil {
+			return nil, err
+		}
+		var record []string
+		if err := json.Unmarshal([]byte(encoded), &record); err != nil {
+			return nil, fmt.Errorf("corrupted record: %v", err)
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
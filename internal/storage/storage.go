@@ -0,0 +1,26 @@
+package storage
+
+// CourseInfo identifies a stored course. ID is the stable storage key, Name
+// is the display name as last seen on Moodle.
+type CourseInfo struct {
+	ID   string
+	Name string
+}
+
+// Storage persists course snapshots and the grade history. Records are the
+// string slices produced by the model types; ReadCourse returns an error
+// matching os.ErrNotExist for a course that was never written.
+type Storage interface {
+	WriteCourse(course CourseInfo, records [][]string) error
+	ReadCourse(id string) ([][]string, error)
+	ListCourses() ([]CourseInfo, error)
+	// MigrateCourse moves a snapshot stored under the course display name
+	// (before courses were keyed by ID) to the course ID. It reports whether
+	// anything was moved.
+	MigrateCourse(course CourseInfo) (bool, error)
+
+	AppendHistory(records [][]string) error
+	ReadHistory() ([][]string, error)
+
+	Close() error
+}
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	backends := []struct {
+		name string
+		open func(dir string) (Storage, error)
+	}{
+		{
+			name: "csv",
+			open: func(dir string) (Storage, error) {
+				return NewCSVStorage(filepath.Join(dir, "courses"), filepath.Join(dir, "history"))
+			},
+		},
+		{
+			name: "sqlite",
+			open: func(dir string) (Storage, error) {
+				return NewSQLiteStorage(filepath.Join(dir, "grades.db"))
+			},
+		},
+	}
+
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := backend.open(dir)
+			require.NoError(t, err)
+
+			_, err = s.ReadCourse("42")
+			assert.ErrorIs(t, err, os.ErrNotExist)
+
+			records := [][]string{{"Quiz", "", "5.00"}, {"Midterm", "", "40.00"}}
+			require.NoError(t, s.WriteCourse(CourseInfo{ID: "42", Name: "Calculus II"}, records))
+			require.NoError(t, s.WriteCourse(CourseInfo{ID: "42", Name: "Calculus II-Merged"}, records[:1]))
+
+			courses, err := s.ListCourses()
+			require.NoError(t, err)
+			assert.Equal(t, []CourseInfo{{ID: "42", Name: "Calculus II-Merged"}}, courses)
+
+			got, err := s.ReadCourse(courses[0].ID)
+			require.NoError(t, err)
+			assert.Equal(t, records[:1], got)
+
+			require.NoError(t, s.AppendHistory([][]string{{"a", "1"}}))
+			require.NoError(t, s.AppendHistory([][]string{{"b", "2"}}))
+			history, err := s.ReadHistory()
+			require.NoError(t, err)
+			assert.Equal(t, [][]string{{"a", "1"}, {"b", "2"}}, history)
+			require.NoError(t, s.Close())
+
+			// Data and schema survive reopening.
+			s, err = backend.open(dir)
+			require.NoError(t, err)
+			defer s.Close()
+			got, err = s.ReadCourse("42")
+			require.NoError(t, err)
+			assert.Equal(t, records[:1], got)
+		})
+	}
+}
+
+func TestCSVStorage_MigrateCourse(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewCSVStorage(dir, filepath.Join(dir, "history"))
+	require.NoError(t, err)
+
+	records := [][]string{{"Quiz", "", "5.00"}}
+	require.NoError(t, s.courses.Write("Calculus_II_grades.csv", records))
+
+	courses, err := s.ListCourses()
+	require.NoError(t, err)
+	assert.Equal(t, []CourseInfo{{ID: "Calculus_II", Name: "Calculus_II"}}, courses)
+
+	moved, err := s.MigrateCourse(CourseInfo{ID: "42", Name: "Calculus II"})
+	require.NoError(t, err)
+	assert.True(t, moved)
+
+	got, err := s.ReadCourse("42")
+	require.NoError(t, err)
+	assert.Equal(t, records, got)
+
+	courses, err = s.ListCourses()
+	require.NoError(t, err)
+	assert.Equal(t, []CourseInfo{{ID: "42", Name: "Calculus II"}}, courses)
+
+	moved, err = s.MigrateCourse(CourseInfo{ID: "42", Name: "Calculus II"})
+	require.NoError(t, err)
+	assert.False(t, moved)
+}
@@ -4,29 +4,108 @@ import (
 	"context"
 	"encoding/json"
 	"log/slog"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/notify"
 	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/service"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/users"
 	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// BotAPI is the part of the Telegram Bot API the bot uses. *tapi.BotAPI
+// implements it; tests use telegramtest.FakeBot.
+type BotAPI interface {
+	Send(c tapi.Chattable) (tapi.Message, error)
+	Request(c tapi.Chattable) (*tapi.APIResponse, error)
+	GetUpdatesChan(config tapi.UpdateConfig) tapi.UpdatesChannel
+	// MakeRequest calls methods the library has no config for, such as
+	// setWebhook with a secret token.
+	MakeRequest(endpoint string, params tapi.Params) (*tapi.APIResponse, error)
+}
+
 type TelegramBot struct {
-	bot      *tapi.BotAPI
-	targetID int64
+	bot        BotAPI
+	targetID   int64
+	allowedIDs []int64
+	webhook    webhookConfig
+	queue      *SendQueue
+
+	users *users.Registry
+	// ownerNotifiers receive the owner's changes in addition to Telegram.
+	ownerNotifiers notify.Fanout
+	quietHours     notify.Window
+	heldChanges    *notify.HeldStore
+	notifyMode     string
+	gpa            model.GPAConfig
+	notifiersMux   sync.Mutex
+	notifiers      map[int64]notify.Notifier
+	// syncSem limits how many users are synced at once, for scheduled and
+	// manual syncs together.
+	syncSem     chan struct{}
+	syncTimeout time.Duration
+	// tasks are the slow handlers running off the update loop.
+	tasks sync.WaitGroup
 
-	gradeService *service.GradeService
+	loginMux sync.Mutex
+	logins   map[int64]*loginState
+	// whatIfs are the chats asked for what-if scores.
+	whatIfMux sync.Mutex
+	whatIfs   map[int64]whatIfState
 }
 
-func NewTelegramBot(cfg config.TelegramConfig, gradeService *service.GradeService) *TelegramBot {
-	botAPI, err := tapi.NewBotAPI(cfg.TelegramToken)
+// Options are everything NewTelegramBot needs besides the Telegram API.
+type Options struct {
+	Config config.TelegramConfig
+	Users  *users.Registry
+	// SyncConcurrency is how many users are synced at once, at least one.
+	SyncConcurrency int
+	// SyncTimeout bounds a whole sync of one user.
+	SyncTimeout time.Duration
+	// OwnerNotifiers receive the owner's changes in addition to Telegram.
+	OwnerNotifiers notify.Fanout
+	QuietHours     notify.Window
+	// HeldChanges keeps changes held during quiet hours; nil keeps them in
+	// memory only.
+	HeldChanges *notify.HeldStore
+	GPA         model.GPAConfig
+}
+
+func NewTelegramBot(botAPI BotAPI, opts Options) *TelegramBot {
+	cfg := opts.Config
+	queue, err := NewSendQueue(botAPI, cfg.TelegramQueueFile, cfg.TelegramChatInterval)
 	if err != nil {
 		panic(err)
 	}
 
+	heldChanges := opts.HeldChanges
+	if heldChanges == nil {
+		heldChanges, err = notify.NewHeldStore("")
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	bot := &TelegramBot{
-		bot:          botAPI,
-		targetID:     cfg.TelegramID,
-		gradeService: gradeService,
+		bot:            botAPI,
+		targetID:       cfg.TelegramID,
+		allowedIDs:     cfg.TelegramAllowedIDs,
+		webhook:        newWebhookConfig(cfg),
+		queue:          queue,
+		users:          opts.Users,
+		ownerNotifiers: opts.OwnerNotifiers,
+		quietHours:     opts.QuietHours,
+		heldChanges:    heldChanges,
+		notifyMode:     cfg.TelegramNotifyMode,
+		gpa:            opts.GPA,
+		notifiers:      map[int64]notify.Notifier{},
+		syncSem:        make(chan struct{}, max(opts.SyncConcurrency, 1)),
+		syncTimeout:    opts.SyncTimeout,
+		logins:         map[int64]*loginState{},
+		whatIfs:        map[int64]whatIfState{},
 	}
 
 	err = bot.SetCommands()
@@ -40,9 +119,15 @@ func NewTelegramBot(cfg config.TelegramConfig, gradeService *service.GradeServic
 func (b *TelegramBot) SetCommands() error {
 	commandsConfig := tapi.NewSetMyCommands([]tapi.BotCommand{
 		{Command: "start", Description: "Start the bot"},
+		{Command: "login", Description: "Connect your Moodle account"},
+		{Command: "logout", Description: "Forget your Moodle account"},
 		{Command: "sync", Description: "Trigger a manual sync"},
 		{Command: "status", Description: "Get the last sync time"},
 		{Command: "list", Description: "List available courses"},
+		{Command: "history", Description: "Show grade history of a course"},
+		{Command: "need", Description: "Grade needed on the rest of a course for a target"},
+		{Command: "whatif", Description: "Course standing with hypothetical scores"},
+		{Command: "gpa", Description: "Letter grades and GPA, /gpa <term> or all, add csv to export"},
 	}...)
 
 	_, err := b.bot.Request(commandsConfig)
@@ -52,28 +137,55 @@ func (b *TelegramBot) SetCommands() error {
 	return nil
 }
 
-func (b *TelegramBot) RunOutputWorker(output <-chan string) {
-	for msg := range output {
-		err := b.SendToTarget(msg)
-		if err != nil {
-			slog.Error("Failed to send message", "error", err)
-		}
+func (b *TelegramBot) Run(ctx context.Context) error {
+	updates, stop, err := b.updates()
+	if err != nil {
+		return err
 	}
-}
+	defer stop()
 
-func (b *TelegramBot) Run(ctx context.Context) {
-	u := tapi.NewUpdate(0)
-	u.Timeout = 60
-	updates := b.bot.GetUpdatesChan(u)
+	queueDone := make(chan struct{})
+	go func() {
+		defer close(queueDone)
+		b.queue.Run(ctx)
+	}()
 
 	b.StartMessage()
+	b.restoreHeldChanges()
 	const NumWorker = 1
 	for range NumWorker {
 		go b.runHandlerWorker(ctx, updates)
 	}
 
 	<-ctx.Done()
+	b.tasks.Wait()
+	<-queueDone
 	b.DeadMessage()
+	return nil
+}
+
+// updates starts receiving updates by webhook or long polling, depending on
+// TELEGRAM_MODE.
+func (b *TelegramBot) updates() (tapi.UpdatesChannel, func(), error) {
+	if b.webhook.enabled {
+		return b.startWebhook()
+	}
+
+	// A webhook left over from webhook mode would make getUpdates fail.
+	if _, err := b.bot.Request(tapi.DeleteWebhookConfig{}); err != nil {
+		slog.Warn("Failed to delete webhook", "error", err)
+	}
+
+	u := tapi.NewUpdate(0)
+	u.Timeout = 60
+	return b.bot.GetUpdatesChan(u), func() {}, nil
+}
+
+// background runs a handler that waits on Moodle, like a manual sync or a
+// login check, off the update loop so other chats are not kept waiting. It
+// replies through the send queue; Run waits for it before returning.
+func (b *TelegramBot) background(f func()) {
+	b.tasks.Go(f)
 }
 
 func (b *TelegramBot) runHandlerWorker(ctx context.Context, updates <-chan tapi.Update) {
@@ -87,16 +199,38 @@ func (b *TelegramBot) runHandlerWorker(ctx context.Context, updates <-chan tapi.
 			}
 			if update.CallbackQuery != nil {
 				b.HandleCallbacks(*update.CallbackQuery)
+			} else if update.Message == nil {
+				continue
 			} else if update.Message.Command() != "" {
-				b.HandleCommands(update)
+				b.HandleCommands(ctx, update)
+			} else {
+				b.HandleConversation(ctx, *update.Message)
 			}
 		}
 	}
 }
 
+// isAllowed reports whether the chat may use the bot: the owner, the chats
+// listed in TELEGRAM_ALLOWED_IDS and anyone already registered.
+func (b *TelegramBot) isAllowed(chatID int64) bool {
+	if chatID == b.targetID || slices.Contains(b.allowedIDs, chatID) {
+		return true
+	}
+	_, err := b.users.Service(chatID)
+	return err == nil
+}
+
 func (b *TelegramBot) IsFromMe(update tapi.Update) bool {
+	if update.CallbackQuery != nil {
+		chatID := callbackChatID(*update.CallbackQuery)
+		if !b.isAllowed(chatID) {
+			slog.Warn("Received callback from unauthorized user", "chat", chatID, "data", update.CallbackQuery.Data)
+			return false
+		}
+	}
+
 	if update.Message != nil {
-		if update.Message.Chat.ID != b.targetID {
+		if !b.isAllowed(update.Message.Chat.ID) {
 			s, err := json.Marshal(update.Message.Chat)
 			if err != nil {
 				slog.Error("Failed to marshal chat", "error", err)
@@ -115,3 +249,24 @@ func (b *TelegramBot) IsFromMe(update tapi.Update) bool {
 	}
 	return true
 }
+
+// userService returns the grade service of the chat, telling the user to
+// log in when there is none.
+func (b *TelegramBot) userService(chatID int64) (*service.GradeService, bool) {
+	svc, err := b.users.Service(chatID)
+	if err != nil {
+		b.SendError(chatID, "You are not logged in, use /login first")
+		return nil, false
+	}
+	return svc, true
+}
+
+func callbackChatID(callback tapi.CallbackQuery) int64 {
+	if callback.Message != nil {
+		return callback.Message.Chat.ID
+	}
+	if callback.From != nil {
+		return callback.From.ID
+	}
+	return 0
+}
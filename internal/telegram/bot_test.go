@@ -0,0 +1,308 @@
+package telegram
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/service"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/storage"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/telegramtest"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/users"
+	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	ownerID   int64 = 1
+	allowedID int64 = 2
+	strangeID int64 = 3
+)
+
+var _ BotAPI = (*telegramtest.FakeBot)(nil)
+
+// stubSource serves one course with fixed grades.
+type stubSource struct{}
+
+func (stubSource) Courses(ctx context.Context) ([]model.Course, error) {
+	return []model.Course{{ID: "101", Name: "Calculus II"}}, nil
+}
+
+func (stubSource) CourseGrades(ctx context.Context, course model.Course) (string, []*model.GradeRow, error) {
+	return course.Name, []*model.GradeRow{
+		model.NewGradeRow([]string{"Quiz 1", "10.00 %", "8.00", "0–10", "80.00 %"}),
+		model.NewGradeRow([]string{"Final", "90.00 %", "-", "0–100", "-"}),
+	}, nil
+}
+
+type stubBackend struct {
+	dir string
+	// verifying, when set, holds every Verify until it is closed.
+	verifying chan struct{}
+}
+
+func (b stubBackend) Verify(ctx context.Context, u users.User) (users.User, error) {
+	if b.verifying != nil {
+		<-b.verifying
+	}
+	return u, nil
+}
+
+func (b stubBackend) Forget(u users.User) error {
+	return nil
+}
+
+func (b stubBackend) NewService(u users.User) (*service.GradeService, error) {
+	store, err := storage.NewCSVStorage(filepath.Join(b.dir, "courses"), filepath.Join(b.dir, "history"))
+	if err != nil {
+		return nil, err
+	}
+	return service.NewGradeService(stubSource{}, store, 1), nil
+}
+
+func newTestBot(t *testing.T) (*TelegramBot, *telegramtest.FakeBot) {
+	t.Helper()
+	return newTestBotWithBackend(t, stubBackend{dir: t.TempDir()})
+}
+
+func newTestBotWithBackend(t *testing.T, backend stubBackend) (*TelegramBot, *telegramtest.FakeBot) {
+	t.Helper()
+
+	registry, err := users.NewRegistry(filepath.Join(t.TempDir(), "users.json"), "passphrase", backend)
+	require.NoError(t, err)
+	require.NoError(t, registry.AddOwner(ownerID))
+	t.Cleanup(func() { registry.Close() })
+
+	svc, err := registry.Service(ownerID)
+	require.NoError(t, err)
+	_, err = svc.ParseAndCompare(context.Background())
+	require.NoError(t, err)
+
+	api := telegramtest.NewFakeBot()
+	bot := NewTelegramBot(api, Options{
+		Config: config.TelegramConfig{
+			TelegramID:         ownerID,
+			TelegramAllowedIDs: []int64{allowedID},
+		},
+		Users:           registry,
+		SyncConcurrency: 1,
+		SyncTimeout:     time.Minute,
+		GPA:             testGPAConfig(t),
+	})
+	bot.queue.globalInterval = 0
+	api.Reset()
+	return bot, api
+}
+
+func testGPAConfig(t *testing.T) model.GPAConfig {
+	t.Helper()
+	scale, err := model.ParseGradeScale(config.DefaultGradeScale)
+	require.NoError(t, err)
+	return model.GPAConfig{Scale: scale, Credits: model.Credits{"calculus": 4}}
+}
+
+// flush waits for the background handlers and delivers everything queued so
+// far.
+func flush(t *testing.T, bot *TelegramBot) {
+	t.Helper()
+	bot.tasks.Wait()
+	flushQueue(t, bot.queue)
+}
+
+func TestHandleConversation_SlowLogin(t *testing.T) {
+	verifying := make(chan struct{})
+	bot, api := newTestBotWithBackend(t, stubBackend{dir: t.TempDir(), verifying: verifying})
+	ctx := context.Background()
+
+	bot.HandleCommands(ctx, telegramtest.Message(allowedID, "/login"))
+	bot.HandleConversation(ctx, *telegramtest.Message(allowedID, "student").Message)
+	bot.HandleConversation(ctx, *telegramtest.Message(allowedID, "secret").Message)
+
+	// Other chats are answered while Moodle checks the password.
+	bot.HandleCommands(ctx, telegramtest.Message(ownerID, "/start"))
+	flushQueue(t, bot.queue)
+	assert.Equal(t, []string{"Send your Moodle username (or /cancel)", "Send your Moodle password. The message will be deleted right away.", "Bot is running!"}, sentTexts(api))
+
+	api.Reset()
+	close(verifying)
+	flush(t, bot)
+	assert.Equal(t, []string{"✅ Logged in. The first /sync stores your current grades, later syncs report changes."}, sentTexts(api))
+}
+
+func TestIsFromMe(t *testing.T) {
+	testcases := []struct {
+		name     string
+		update   tapi.Update
+		expected bool
+		replied  bool
+	}{
+		{name: "owner message", update: telegramtest.Message(ownerID, "/start"), expected: true},
+		{name: "allowed message", update: telegramtest.Message(allowedID, "hi"), expected: true},
+		{name: "stranger message", update: telegramtest.Message(strangeID, "/list"), expected: false, replied: true},
+		{name: "owner callback", update: telegramtest.Callback(ownerID, "crs:101"), expected: true},
+		{name: "stranger callback", update: telegramtest.Callback(strangeID, "crs:101"), expected: false},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			bot, api := newTestBot(t)
+
+			assert.Equal(t, tc.expected, bot.IsFromMe(tc.update))
+			flush(t, bot)
+			if tc.replied {
+				sent := api.Sent()
+				require.Len(t, sent, 1)
+				assert.Equal(t, strangeID, sent[0].ChatID)
+			} else {
+				assert.Empty(t, api.Sent())
+			}
+		})
+	}
+}
+
+func TestHandleCommands(t *testing.T) {
+	testcases := []struct {
+		name     string
+		chatID   int64
+		text     string
+		expected []string
+		keyboard []string
+	}{
+		{name: "start owner", chatID: ownerID, text: "/start", expected: []string{"Bot is running!"}},
+		{name: "start not logged in", chatID: allowedID, text: "/start", expected: []string{"Bot is running! Use /login to connect your Moodle account."}},
+		{name: "status not logged in", chatID: allowedID, text: "/status", expected: []string{"❗️ You are not logged in, use /login first"}},
+		{name: "status", chatID: ownerID, text: "/status", expected: []string{"Last parsed at: "}},
+		{name: "list", chatID: ownerID, text: "/list", expected: []string{"Available courses:"}, keyboard: []string{"Calculus II"}},
+		{name: "history usage", chatID: ownerID, text: "/history", expected: []string{"❗️ Usage: /history &lt;course&gt;"}},
+		{name: "history", chatID: ownerID, text: "/history calc", expected: []string{"<b>Calculus II</b>\nQuiz 1\n"}},
+		{name: "history unknown course", chatID: ownerID, text: "/history physics", expected: []string{"❗️ course not found: physics"}},
+		{name: "login owner", chatID: ownerID, text: "/login", expected: []string{"❗️ The owner account is configured in .env"}},
+		{name: "login", chatID: allowedID, text: "/login", expected: []string{"Send your Moodle username (or /cancel)"}},
+		{name: "need", chatID: ownerID, text: "/need calc 50", expected: []string{"🎯 <b>Calculus II</b>, target 50%\n📊 Current: <b>80%</b>, 10% of the course graded, 8% earned\n\nYou need an average of <b>46.67%</b> on the remaining 90% of the course."}},
+		{name: "need secured", chatID: ownerID, text: "/need Calculus II 5%", expected: []string{"🎯 <b>Calculus II</b>, target 5%"}},
+		{name: "need usage", chatID: ownerID, text: "/need calc", expected: []string{"❗️ Usage: /need &lt;course&gt; &lt;target%&gt;"}},
+		{name: "need bad target", chatID: ownerID, text: "/need calc 120", expected: []string{"❗️ The target must be a percentage between 0 and 100"}},
+		{name: "need unknown course", chatID: ownerID, text: "/need physics 50", expected: []string{"❗️ course not found: physics"}},
+		{name: "whatif", chatID: ownerID, text: "/whatif calc Final=72.5%", expected: []string{"🔮 <b>Calculus II</b>, what if:\nFinal 72.5% (72.5/100)\n\nNow:"}},
+		{name: "whatif usage", chatID: ownerID, text: "/whatif Final=80", expected: []string{"❗️ Usage: /whatif &lt;course&gt;"}},
+		{name: "whatif bad item", chatID: ownerID, text: "/whatif calc Midterm=80", expected: []string{"❗️ no item matches &#34;Midterm&#34;"}},
+		{name: "gpa", chatID: ownerID, text: "/gpa", expected: []string{"🎓 GPA: <b>3</b> over 4 credits\n\nCalculus II: 80% <b>B</b> (3 × 4 cr)"}},
+		{name: "gpa all", chatID: ownerID, text: "/gpa all", expected: []string{"🎓 GPA: <b>3</b> over 4 credits\n\nCalculus II: 80% <b>B</b> (3 × 4 cr)"}},
+		{name: "gpa unknown term", chatID: ownerID, text: "/gpa Fall 2030", expected: []string{"❗️ No courses in Fall 2030, try /gpa all"}},
+		{name: "gpa not logged in", chatID: allowedID, text: "/gpa", expected: []string{"❗️ You are not logged in, use /login first"}},
+		{name: "unknown", chatID: ownerID, text: "/unknown"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			bot, api := newTestBot(t)
+
+			bot.HandleCommands(context.Background(), telegramtest.Message(tc.chatID, tc.text))
+			flush(t, bot)
+
+			sent := api.Sent()
+			require.Len(t, sent, len(tc.expected))
+			for i, msg := range sent {
+				assert.Equal(t, tc.chatID, msg.ChatID)
+				assert.True(t, strings.HasPrefix(msg.Text, tc.expected[i]), "got %q", msg.Text)
+			}
+
+			var buttons []string
+			for _, msg := range sent {
+				for _, row := range msg.Keyboard {
+					for _, button := range row {
+						buttons = append(buttons, button.Text)
+					}
+				}
+			}
+			assert.Equal(t, tc.keyboard, buttons)
+		})
+	}
+}
+
+func TestHandleCallbacks(t *testing.T) {
+	testcases := []struct {
+		name     string
+		chatID   int64
+		data     string
+		expected []string
+	}{
+		{name: "course", chatID: ownerID, data: "crs:101", expected: []string{"Grades for course: Calculus II (2)"}},
+		{name: "unknown course", chatID: ownerID, data: "crs:999", expected: []string{"❗️ Course not found"}},
+		{name: "missing course id", chatID: ownerID, data: "crs"},
+		{name: "not logged in", chatID: allowedID, data: "crs:101", expected: []string{"❗️ You are not logged in, use /login first"}},
+		{name: "unknown data", chatID: ownerID, data: "bogus:1"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			bot, api := newTestBot(t)
+
+			bot.HandleCallbacks(*telegramtest.Callback(tc.chatID, tc.data).CallbackQuery)
+			flush(t, bot)
+
+			sent := api.Sent()
+			require.Len(t, sent, len(tc.expected))
+			for i, msg := range sent {
+				assert.Equal(t, tc.chatID, msg.ChatID)
+				assert.True(t, strings.HasPrefix(msg.Text, tc.expected[i]), "got %q", msg.Text)
+			}
+		})
+	}
+}
+
+func TestCallbackCourse_Standing(t *testing.T) {
+	bot, api := newTestBot(t)
+
+	bot.CallbackCourse(ownerID, "101")
+	flush(t, bot)
+
+	sent := api.Sent()
+	require.Len(t, sent, 1)
+	assert.Contains(t, sent[0].Text, "📊 Current: <b>80%</b>, 10% of the course graded, 8% earned")
+}
+
+func TestRunHandlerWorker(t *testing.T) {
+	bot, api := newTestBot(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go bot.queue.Run(ctx)
+	go bot.runHandlerWorker(ctx, api.GetUpdatesChan(tapi.NewUpdate(0)))
+
+	api.Inject(telegramtest.Message(strangeID, "/start"))
+	api.Inject(telegramtest.Message(ownerID, "/start"))
+
+	require.Eventually(t, func() bool { return len(api.Sent()) == 2 }, time.Second, 10*time.Millisecond)
+	sent := api.Sent()
+	assert.Equal(t, strangeID, sent[0].ChatID)
+	assert.Equal(t, ownerID, sent[1].ChatID)
+	assert.Equal(t, "Bot is running!", sent[1].Text)
+}
+
+func TestHandleGPA_CSV(t *testing.T) {
+	bot, api := newTestBot(t)
+
+	bot.HandleCommands(context.Background(), telegramtest.Message(ownerID, "/gpa csv"))
+	// The file goes through the send queue.
+	assert.Empty(t, api.Requests())
+	flush(t, bot)
+
+	assert.Empty(t, api.Sent())
+	requests := api.Requests()
+	require.Len(t, requests, 1)
+	doc, ok := requests[0].(tapi.DocumentConfig)
+	require.True(t, ok)
+	assert.Equal(t, ownerID, doc.ChatID)
+	assert.Equal(t, "GPA 3", doc.Caption)
+
+	file, ok := doc.File.(tapi.FileBytes)
+	require.True(t, ok)
+	assert.Equal(t, "gpa.csv", file.Name)
+	assert.Equal(t, "Course,Percent,Letter,Points,Credits,Counted\nCalculus II,80,B,3,4,true\nGPA,,,3,4,\n", string(file.Bytes))
+}
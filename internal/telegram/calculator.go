@@ -0,0 +1,340 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/service"
+)
+
+// courseGrades looks up a course by name and returns its stored rows,
+// telling the user when that fails.
+func (b *TelegramBot) courseGrades(chatID int64, svc *service.GradeService, query string) (model.Course, []*model.GradeRow, bool) {
+	course, err := svc.FindCourse(query)
+	if errors.Is(err, service.ErrCourseNotFound) || errors.Is(err, service.ErrAmbiguousCourse) {
+		b.Send(chatID, escape(err.Error()))
+		return model.Course{}, nil, false
+	}
+	if err != nil {
+		slog.Error("Failed to find course", "course", query, "error", err)
+		b.SendError(chatID, "Failed to get course list")
+		return model.Course{}, nil, false
+	}
+
+	rows, err := svc.GetCourseGrades(course.ID)
+	if err != nil {
+		slog.Error("Failed to get course grades", "course", course.Name, "error", err)
+		b.SendError(chatID, "Failed to get course grades for "+course.Name)
+		return model.Course{}, nil, false
+	}
+	return course, rows, true
+}
+
+// parsePercent reads a target such as "85", "85%" or "72,5 %".
+func parsePercent(s string) (float64, bool) {
+	v := model.ParseGradeValue(s)
+	if !v.IsGraded() || v.Value < 0 || v.Value > 100 {
+		return 0, false
+	}
+	return v.Value, true
+}
+
+// HandleNeed answers "/need <course> <target%>" with the average the
+// ungraded items of the course need for the course total to reach target.
+func (b *TelegramBot) HandleNeed(chatID int64, args string) {
+	svc, ok := b.userService(chatID)
+	if !ok {
+		return
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		b.SendError(chatID, "Usage: /need <course> <target%>, e.g. /need calculus 85")
+		return
+	}
+	target, ok := parsePercent(fields[len(fields)-1])
+	if !ok {
+		b.SendError(chatID, "The target must be a percentage between 0 and 100")
+		return
+	}
+
+	course, rows, ok := b.courseGrades(chatID, svc, strings.Join(fields[:len(fields)-1], " "))
+	if !ok {
+		return
+	}
+
+	req, ok := model.Need(rows, target)
+	if !ok {
+		b.SendError(chatID, "The grade report of "+course.Name+" has no weights or ranges to calculate with")
+		return
+	}
+
+	var mb MessageBuilder
+	mb.Linef("🎯 <b>%s</b>, target %s%%", course.Name, model.FormatNumber(target))
+	if req.Standing.Graded > 0 {
+		mb.Line(standingLine(req.Standing))
+	}
+	mb.Line("")
+
+	remaining := model.FormatNumber(req.Remaining)
+	switch {
+	case req.Remaining == 0 && req.Secured():
+		mb.Linef("✅ Everything is graded and the course stands at %s%%.", model.FormatNumber(req.Min))
+	case req.Remaining == 0:
+		mb.Linef("❌ Everything is graded and the course stands at %s%%.", model.FormatNumber(req.Min))
+	case req.Secured():
+		mb.Linef("✅ Already secured: even 0%% on the remaining %s%% of the course gives %s%%.", remaining, model.FormatNumber(req.Min))
+	case req.Impossible():
+		mb.Linef("❌ Not reachable: even 100%% on the remaining %s%% of the course gives %s%%.", remaining, model.FormatNumber(req.Max))
+	default:
+		mb.Linef("You need an average of <b>%s%%</b> on the remaining %s%% of the course.", model.FormatNumber(req.Needed), remaining)
+	}
+
+	err := b.Send(chatID, mb.String())
+	if err != nil {
+		slog.Error("Failed to send requirement", "error", err)
+	}
+}
+
+// whatIfPattern matches one "Item=score" of a what-if, e.g. "Quiz 5=9/10".
+// Assignments are separated by spaces, commas or semicolons.
+var whatIfPattern = regexp.MustCompile(`([^=,;]+?)\s*=\s*([^\s,;]+)`)
+
+// HandleWhatIf answers "/whatif <course> Item=score ..." with the course
+// standing as if the items had those scores. The first item name must not
+// contain spaces, the course view's what-if button has no such limit.
+func (b *TelegramBot) HandleWhatIf(chatID int64, args string) {
+	svc, ok := b.userService(chatID)
+	if !ok {
+		return
+	}
+
+	fields := strings.Fields(args)
+	first := slices.IndexFunc(fields, func(f string) bool { return strings.Contains(f, "=") })
+	if first < 1 {
+		b.SendError(chatID, "Usage: /whatif <course> <item>=<score> ..., e.g. /whatif calculus Final=80 Quiz5=9/10")
+		return
+	}
+
+	course, rows, ok := b.courseGrades(chatID, svc, strings.Join(fields[:first], " "))
+	if !ok {
+		return
+	}
+	b.sendWhatIf(chatID, course, rows, strings.Join(fields[first:], " "))
+}
+
+// whatIfTTL is how long a what-if prompt waits for the scores.
+const whatIfTTL = 10 * time.Minute
+
+// whatIfState is a what-if prompt waiting for the scores of a course.
+type whatIfState struct {
+	courseID string
+	asked    time.Time
+}
+
+// CallbackWhatIf starts a what-if from the course view: the next message of
+// the chat is taken as the hypothetical scores.
+func (b *TelegramBot) CallbackWhatIf(chatID int64, courseID string) {
+	svc, ok := b.userService(chatID)
+	if !ok {
+		return
+	}
+	course, ok := b.callbackCourse(chatID, svc, courseID)
+	if !ok {
+		return
+	}
+	rows, err := svc.GetCourseGrades(course.ID)
+	if err != nil {
+		slog.Error("Failed to get course grades", "course", course.Name, "error", err)
+		b.SendError(chatID, "Failed to get course grades for "+course.Name)
+		return
+	}
+
+	b.whatIfMux.Lock()
+	b.whatIfs[chatID] = whatIfState{courseID: course.ID, asked: time.Now()}
+	b.whatIfMux.Unlock()
+
+	b.loginMux.Lock()
+	delete(b.logins, chatID)
+	b.loginMux.Unlock()
+
+	var ungraded []string
+	for _, row := range rows {
+		if !row.IsTotal() && row.ScoreValue.State == model.NotGraded {
+			ungraded = append(ungraded, row.AssName)
+		}
+	}
+
+	var mb MessageBuilder
+	mb.Linef("🔮 Send hypothetical scores for <b>%s</b>, e.g. <code>Final=80 Quiz 5=9/10</code> (or /cancel)", course.Name)
+	if len(ungraded) > 0 {
+		mb.Linef("Not graded yet: %s", strings.Join(ungraded, ", "))
+	}
+	err = b.Send(chatID, mb.String())
+	if err != nil {
+		slog.Error("Failed to send what-if prompt", "error", err)
+	}
+}
+
+// clearWhatIf drops the pending what-if of the chat and reports whether
+// there was one.
+func (b *TelegramBot) clearWhatIf(chatID int64) bool {
+	b.whatIfMux.Lock()
+	defer b.whatIfMux.Unlock()
+	_, ok := b.whatIfs[chatID]
+	delete(b.whatIfs, chatID)
+	return ok
+}
+
+// handleWhatIfAnswer runs the what-if started by CallbackWhatIf. It is false
+// when the chat has none pending or the prompt has expired.
+func (b *TelegramBot) handleWhatIfAnswer(chatID int64, text string) bool {
+	b.whatIfMux.Lock()
+	state, ok := b.whatIfs[chatID]
+	delete(b.whatIfs, chatID)
+	b.whatIfMux.Unlock()
+	if !ok || time.Since(state.asked) > whatIfTTL {
+		return false
+	}
+	courseID := state.courseID
+
+	svc, ok := b.userService(chatID)
+	if !ok {
+		return true
+	}
+	course, rows, ok := b.courseGrades(chatID, svc, courseID)
+	if !ok {
+		return true
+	}
+	b.sendWhatIf(chatID, course, rows, text)
+	return true
+}
+
+func (b *TelegramBot) sendWhatIf(chatID int64, course model.Course, rows []*model.GradeRow, assignments string) {
+	fractions, err := parseWhatIf(rows, assignments)
+	if err != nil {
+		b.SendError(chatID, err.Error())
+		return
+	}
+
+	var mb MessageBuilder
+	mb.Linef("🔮 <b>%s</b>, what if:", course.Name)
+	for _, row := range rows {
+		if f, ok := fractions[row]; ok {
+			mb.Linef("%s", row.WithFraction(f).StringWithName())
+		}
+	}
+	mb.Line("")
+
+	if st, ok := model.ComputeStanding(rows); ok {
+		mb.Line("Now:")
+		mb.Line(standingLine(st))
+	}
+	if st, ok := model.ComputeStanding(model.WhatIf(rows, fractions)); ok {
+		mb.Line("With these scores:")
+		mb.Line(standingLine(st))
+	} else {
+		mb.Line("The grade report has no weights or ranges to calculate with.")
+	}
+
+	err = b.Send(chatID, mb.String())
+	if err != nil {
+		slog.Error("Failed to send what-if", "error", err)
+	}
+}
+
+// parseWhatIf reads assignments like "Final=80 Quiz5=9/10 Lab=75%" into the
+// share of the range each item would get. A plain number is points on the
+// item's range.
+func parseWhatIf(rows []*model.GradeRow, assignments string) (map[*model.GradeRow]float64, error) {
+	matches := whatIfPattern.FindAllStringSubmatch(assignments, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no scores given, write them as <item>=<score>")
+	}
+
+	fractions := map[*model.GradeRow]float64{}
+	for _, m := range matches {
+		row, err := matchItem(rows, m[1])
+		if err != nil {
+			return nil, err
+		}
+		if !row.RangeValue.Valid {
+			return nil, fmt.Errorf("%s has no range to score against", row.AssName)
+		}
+
+		f, ok := parseScore(m[2], row.RangeValue)
+		if !ok {
+			return nil, fmt.Errorf("%s: %q is not a score, use points, a fraction like 9/10 or a percentage", row.AssName, m[2])
+		}
+		if f < 0 || f > 1 {
+			return nil, fmt.Errorf("%s: %s is outside the range %s", row.AssName, m[2], row.RangeValue)
+		}
+		fractions[row] = f
+	}
+	return fractions, nil
+}
+
+// parseScore returns a score as a share of the range: "9/10" and "90%" are
+// read as such, a plain number as points.
+func parseScore(s string, r model.GradeRange) (float64, bool) {
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, d := model.ParseGradeValue(num), model.ParseGradeValue(den)
+		if !n.IsGraded() || !d.IsGraded() || d.Value <= 0 {
+			return 0, false
+		}
+		return n.Value / d.Value, true
+	}
+
+	v := model.ParseGradeValue(s)
+	if !v.IsGraded() {
+		return 0, false
+	}
+	if strings.HasSuffix(s, "%") {
+		return v.Value / 100, true
+	}
+	if r.Max == r.Min {
+		return 0, false
+	}
+	return (v.Value - r.Min) / (r.Max - r.Min), true
+}
+
+// matchItem finds a grade item by name, ignoring case and spaces. An exact
+// match wins over items that merely contain the name.
+func matchItem(rows []*model.GradeRow, name string) (*model.GradeRow, error) {
+	norm := func(s string) string {
+		return strings.ToLower(strings.Join(strings.Fields(s), ""))
+	}
+	query := norm(name)
+
+	var matches []*model.GradeRow
+	for _, row := range rows {
+		if row.IsTotal() {
+			continue
+		}
+		item := norm(row.AssName)
+		if item == query {
+			return row, nil
+		}
+		if query != "" && strings.Contains(item, query) {
+			matches = append(matches, row)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no item matches %q", strings.TrimSpace(name))
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, row := range matches {
+		names[i] = row.AssName
+	}
+	return nil, fmt.Errorf("%q matches several items: %s", strings.TrimSpace(name), strings.Join(names, ", "))
+}
@@ -0,0 +1,106 @@
+package telegram
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/telegramtest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWhatIf(t *testing.T) {
+	rows := []*model.GradeRow{
+		model.NewGradeRow([]string{"Quiz 5", "10.00 %", "-", "0–10", "-"}),
+		model.NewGradeRow([]string{"Quiz 6", "10.00 %", "-", "0–10", "-"}),
+		model.NewGradeRow([]string{"Final", "60.00 %", "-", "0–50", "-"}),
+		model.NewGradeRow([]string{"Essay", "20.00 %", "-", "", "-"}),
+	}
+
+	testcases := []struct {
+		name     string
+		input    string
+		expected map[string]float64
+		err      string
+	}{
+		{name: "points", input: "Final=40", expected: map[string]float64{"Final": 0.8}},
+		{name: "fraction and percentage", input: "Quiz5=9/10 final=70%", expected: map[string]float64{"Quiz 5": 0.9, "Final": 0.7}},
+		{name: "names with spaces", input: "Quiz 5 = 4, Quiz 6=7.5", expected: map[string]float64{"Quiz 5": 0.4, "Quiz 6": 0.75}},
+		{name: "ambiguous", input: "Quiz=5", err: `"Quiz" matches several items: Quiz 5, Quiz 6`},
+		{name: "unknown", input: "Midterm=5", err: `no item matches "Midterm"`},
+		{name: "no range", input: "Essay=80", err: "Essay has no range to score against"},
+		{name: "out of range", input: "Final=60", err: "Final: 60 is outside the range 0–50"},
+		{name: "not a score", input: "Final=A", err: `Final: "A" is not a score, use points, a fraction like 9/10 or a percentage`},
+		{name: "empty", input: "Final", err: "no scores given, write them as <item>=<score>"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			fractions, err := parseWhatIf(rows, tc.input)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			got := map[string]float64{}
+			for row, f := range fractions {
+				got[row.AssName] = f
+			}
+			assert.InDeltaMapValues(t, tc.expected, got, 1e-9)
+		})
+	}
+}
+
+func TestWhatIf_Callback(t *testing.T) {
+	bot, api := newTestBot(t)
+
+	bot.HandleCallbacks(*telegramtest.Callback(ownerID, "wif:101").CallbackQuery)
+	bot.HandleConversation(context.Background(), *telegramtest.Message(ownerID, "Final=80").Message)
+	// The prompt is answered once.
+	bot.HandleConversation(context.Background(), *telegramtest.Message(ownerID, "Final=90").Message)
+	flush(t, bot)
+
+	sent := api.Sent()
+	require.Len(t, sent, 2)
+	assert.Equal(t, "🔮 Send hypothetical scores for <b>Calculus II</b>, e.g. <code>Final=80 Quiz 5=9/10</code> (or /cancel)\nNot graded yet: Final", sent[0].Text)
+	assert.Equal(t, "🔮 <b>Calculus II</b>, what if:\nFinal 80% (80/100)\n\n"+
+		"Now:\n📊 Current: <b>80%</b>, 10% of the course graded, 8% earned\n"+
+		"With these scores:\n📊 Current: <b>80%</b>, 100% of the course graded, 80% earned", sent[1].Text)
+
+	api.Reset()
+	bot.HandleCallbacks(*telegramtest.Callback(ownerID, "wif:101").CallbackQuery)
+	bot.HandleCommands(context.Background(), telegramtest.Message(ownerID, "/cancel"))
+	bot.HandleConversation(context.Background(), *telegramtest.Message(ownerID, "Final=80").Message)
+	flush(t, bot)
+
+	sent = api.Sent()
+	require.Len(t, sent, 2)
+	assert.Equal(t, "What-if cancelled", sent[1].Text)
+
+	// Another command abandons the prompt.
+	api.Reset()
+	bot.HandleCallbacks(*telegramtest.Callback(ownerID, "wif:101").CallbackQuery)
+	bot.HandleCommands(context.Background(), telegramtest.Message(ownerID, "/status"))
+	bot.HandleConversation(context.Background(), *telegramtest.Message(ownerID, "Final=80").Message)
+	flush(t, bot)
+
+	sent = api.Sent()
+	require.Len(t, sent, 2)
+	assert.Contains(t, sent[1].Text, "Last parsed at")
+
+	// So does waiting too long.
+	api.Reset()
+	bot.HandleCallbacks(*telegramtest.Callback(ownerID, "wif:101").CallbackQuery)
+	bot.whatIfMux.Lock()
+	state := bot.whatIfs[ownerID]
+	state.asked = state.asked.Add(-whatIfTTL - time.Second)
+	bot.whatIfs[ownerID] = state
+	bot.whatIfMux.Unlock()
+	bot.HandleConversation(context.Background(), *telegramtest.Message(ownerID, "Final=80").Message)
+	flush(t, bot)
+
+	require.Len(t, api.Sent(), 1)
+}
@@ -1,12 +1,13 @@
 package telegram
 
 import (
-	"fmt"
 	"log/slog"
+	"slices"
 	"sort"
 	"strings"
 
-	"github.com/TheTeemka/telegram_bot_moodle_grades/pkg/utils"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/service"
 	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -18,65 +19,86 @@ func (b *TelegramBot) HandleCallbacks(callback tapi.CallbackQuery) {
 			slog.Warn("Invalid course callback data", "data", callback.Data)
 			return
 		}
-		courseName := fields[1]
-		b.CallbackCourse(courseName)
+		b.CallbackCourse(callbackChatID(callback), fields[1])
+	case "wif":
+		if len(fields) < 2 {
+			slog.Warn("Invalid what-if callback data", "data", callback.Data)
+			return
+		}
+		b.CallbackWhatIf(callbackChatID(callback), fields[1])
 	default:
 		slog.Warn("Unknown callback data", "data", callback.Data)
 		return
 	}
 }
 
-func (b *TelegramBot) CallbackCourse(compCourseFile string) {
-	slog.Debug("Handling course callback", "course", compCourseFile)
-	var courseFile string
-	courseNames, err := b.gradeService.GetCourseNamesList()
-	if err != nil {
-		slog.Error("Failed to get course names list", "error", err)
-		b.SendError("Failed to get course names list")
+func (b *TelegramBot) CallbackCourse(chatID int64, courseID string) {
+	slog.Debug("Handling course callback", "id", courseID)
+	svc, ok := b.userService(chatID)
+	if !ok {
 		return
 	}
 
-	for _, name := range courseNames {
-		if utils.Compress(name) == compCourseFile {
-			courseFile = name
-			break
-		}
-	}
-
-	if courseFile == "" {
-		slog.Error("Course name not found for callback", "compCourseName", compCourseFile)
-		b.SendError("Course not found")
+	course, ok := b.callbackCourse(chatID, svc, courseID)
+	if !ok {
 		return
 	}
 
-	slog.Debug("Fetching grades for course", "course", courseFile)
+	slog.Debug("Fetching grades for course", "course", course.Name, "id", course.ID)
 
-	rows, err := b.gradeService.GetCourseFile(courseFile)
+	rows, err := svc.GetCourseGrades(course.ID)
 	if err != nil {
-		slog.Error("Failed to get course grades file", "course", courseFile, "error", err)
-		b.SendError("Failed to get course grades file for " + courseFile)
+		slog.Error("Failed to get course grades", "course", course.Name, "error", err)
+		b.SendError(chatID, "Failed to get course grades for "+course.Name)
 		return
 	}
 
-	var sb strings.Builder
-	fmt.Fprintf(&sb, "Grades for course: %s (%d)\n\n", courseFile, len(rows))
-
 	var messageRows []string
 	for _, row := range rows {
+		if row.IsTotal() {
+			continue
+		}
 		messageRows = append(messageRows, row.StringWithName())
 	}
 
 	sort.Strings(messageRows)
 
+	var mb MessageBuilder
+	mb.Linef("Grades for course: %s (%d)", course.Name, len(messageRows))
+	mb.Line("")
 	for i, r := range messageRows {
-		fmt.Fprintf(&sb, "%2d. %s\n", i+1, r)
+		mb.Linef("%2d. %s", i+1, r)
+	}
+	if st, ok := model.ComputeStanding(rows); ok {
+		mb.Line("")
+		mb.Line(standingLine(st))
 	}
 
-	message := sb.String()
-
-	err = b.SendToTarget(message)
+	keyboard := [][]tapi.InlineKeyboardButton{{
+		tapi.NewInlineKeyboardButtonData("🔮 What if…", "wif:"+courseID),
+	}}
+	err = b.SendMessageWithKeyboard(chatID, mb.String(), keyboard)
 	if err != nil {
 		slog.Error("Failed to send course grades", "error", err)
-		b.SendError("Failed to send course grades for " + courseFile)
+		b.SendError(chatID, "Failed to send course grades for "+course.Name)
+	}
+}
+
+// callbackCourse finds the course of callback data, telling the user when
+// there is none.
+func (b *TelegramBot) callbackCourse(chatID int64, svc *service.GradeService, courseID string) (model.Course, bool) {
+	courses, err := svc.GetCourses()
+	if err != nil {
+		slog.Error("Failed to get course list", "error", err)
+		b.SendError(chatID, "Failed to get course list")
+		return model.Course{}, false
+	}
+
+	idx := slices.IndexFunc(courses, func(c model.Course) bool { return callbackCourseID(c.ID) == courseID })
+	if idx < 0 {
+		slog.Error("Course not found for callback", "id", courseID)
+		b.SendError(chatID, "Course not found")
+		return model.Course{}, false
 	}
+	return courses[idx], true
 }
@@ -0,0 +1,112 @@
+package telegram
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+)
+
+// HandleGPA answers "/gpa" with the letter grade of every course of the
+// latest semester and their credit weighted GPA. "/gpa <term>" picks another
+// semester, "/gpa all" every course, and a trailing "csv" sends the same as
+// a CSV file.
+func (b *TelegramBot) HandleGPA(chatID int64, args string) {
+	svc, ok := b.userService(chatID)
+	if !ok {
+		return
+	}
+
+	query := strings.TrimSpace(args)
+	fields := strings.Fields(query)
+	csv := len(fields) > 0 && strings.EqualFold(fields[len(fields)-1], "csv")
+	if csv {
+		query = strings.TrimSpace(query[:len(query)-len("csv")])
+	}
+
+	courses, err := svc.GetAllCourseGrades()
+	if err != nil {
+		slog.Error("Failed to get course grades", "error", err)
+		b.SendError(chatID, "Failed to get course grades")
+		return
+	}
+	if len(courses) == 0 {
+		b.SendError(chatID, "No courses yet, try /sync")
+		return
+	}
+
+	scoped, term, ok := model.ScopeTerm(courses, query)
+	if !ok {
+		b.SendError(chatID, "No courses in "+term+", try /gpa all")
+		return
+	}
+
+	gpa := model.ComputeGPA(scoped, b.gpa)
+	gpa.Term = term
+	if csv {
+		b.sendGPACSV(chatID, gpa)
+		return
+	}
+
+	msg := gpaMessage(gpa)
+	if query == "" && len(scoped) < len(courses) {
+		msg += "\n\nOther semesters: /gpa all, or /gpa &lt;term&gt;"
+	}
+	err = b.Send(chatID, msg)
+	if err != nil {
+		slog.Error("Failed to send GPA", "error", err)
+	}
+}
+
+func gpaMessage(gpa model.GPA) string {
+	var mb MessageBuilder
+	title := "GPA"
+	if gpa.Term != "" {
+		title = gpa.Term + " GPA"
+	}
+	if gpa.Credits > 0 {
+		mb.Linef("🎓 %s: <b>%s</b> over %s credits", title, model.FormatNumber(gpa.Value), model.FormatNumber(gpa.Credits))
+	} else {
+		mb.Line("🎓 No GPA yet, no graded course has credits")
+	}
+	mb.Line("")
+
+	uncounted := false
+	for _, c := range gpa.Courses {
+		switch {
+		case !c.Graded:
+			mb.Linef("%s: not graded yet", c.Course.Name)
+		case c.Credits == 0:
+			mb.Linef("%s: %s%% <b>%s</b>, no credits", c.Course.Name, model.FormatNumber(c.Percent), c.Grade.Letter)
+			uncounted = true
+		default:
+			mb.Linef("%s: %s%% <b>%s</b> (%s × %s cr)", c.Course.Name, model.FormatNumber(c.Percent), c.Grade.Letter,
+				model.FormatNumber(c.Grade.Points), model.FormatNumber(c.Credits))
+		}
+	}
+	if uncounted {
+		mb.Line("")
+		mb.Line("Courses without credits are not counted.")
+	}
+	return mb.String()
+}
+
+// sendGPACSV sends the GPA as a file.
+func (b *TelegramBot) sendGPACSV(chatID int64, gpa model.GPA) {
+	var buf bytes.Buffer
+	if err := gpa.WriteCSV(&buf); err != nil {
+		slog.Error("Failed to write GPA csv", "error", err)
+		b.SendError(chatID, "Failed to export GPA")
+		return
+	}
+
+	caption := "GPA " + model.FormatNumber(gpa.Value)
+	if gpa.Term != "" {
+		caption = gpa.Term + " " + caption
+	}
+	err := b.SendDocument(chatID, "gpa.csv", buf.Bytes(), caption)
+	if err != nil {
+		slog.Error("Failed to send GPA csv", "error", err)
+	}
+}
@@ -1,66 +1,142 @@
 package telegram
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"strings"
+	"sync"
 
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/service"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/users"
 	"github.com/TheTeemka/telegram_bot_moodle_grades/pkg/utils"
 	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-func (b *TelegramBot) HandleCommands(update tapi.Update) {
+func (b *TelegramBot) HandleCommands(ctx context.Context, update tapi.Update) {
 	if update.Message != nil {
-		switch update.Message.Command() {
+		chatID := update.Message.Chat.ID
+		command := update.Message.Command()
+		// Any other command abandons a pending what-if, so a later message
+		// isn't taken as its scores.
+		if command != "" && command != "cancel" {
+			b.clearWhatIf(chatID)
+		}
+		switch command {
 		case "start":
-			b.HandleStart()
+			b.HandleStart(chatID)
+		case "login":
+			b.HandleLogin(chatID)
+		case "logout":
+			b.HandleLogout(chatID)
+		case "cancel":
+			b.HandleCancel(chatID)
 		case "sync":
-			b.HandleManualSync()
+			b.background(func() { b.HandleManualSync(ctx, chatID) })
 		case "status":
-			b.HandlerStatus()
+			b.HandlerStatus(chatID)
 		case "list":
-			b.HandleList()
+			b.HandleList(chatID)
+		case "history":
+			b.HandleHistory(chatID, update.Message.CommandArguments())
+		case "need":
+			b.HandleNeed(chatID, update.Message.CommandArguments())
+		case "whatif":
+			b.HandleWhatIf(chatID, update.Message.CommandArguments())
+		case "gpa":
+			b.HandleGPA(chatID, update.Message.CommandArguments())
 		}
 	}
 }
 
-func (b *TelegramBot) HandleStart() {
-	err := b.SendToTarget("Bot is running!")
+func (b *TelegramBot) HandleStart(chatID int64) {
+	msg := "Bot is running!"
+	if _, err := b.users.Service(chatID); err != nil {
+		msg = "Bot is running! Use /login to connect your Moodle account."
+	}
+	err := b.Send(chatID, msg)
 	if err != nil {
 		slog.Error("Failed to send message", "error", err)
 	}
 }
 
-func (b *TelegramBot) HandleSync() error {
-	changes, err := b.gradeService.ParseAndCompare()
+// HandleSync syncs every registered user and sends each their own changes.
+func (b *TelegramBot) HandleSync(ctx context.Context) error {
+	chatIDs := b.users.ChatIDs()
+	errs := make([]error, len(chatIDs))
+
+	var wg sync.WaitGroup
+	for i, chatID := range chatIDs {
+		wg.Go(func() {
+			errs[i] = b.syncUser(ctx, chatID)
+		})
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// syncUser runs one sync of the chat within the sync timeout. Changes found
+// before a timeout are still delivered.
+func (b *TelegramBot) syncUser(ctx context.Context, chatID int64) error {
+	svc, err := b.users.Service(chatID)
 	if err != nil {
-		b.SendToTarget(err.Error())
-		slog.Error("Failed to parse and compare", "error", err)
 		return err
 	}
 
-	for _, change := range changes {
-		err := b.SendToTarget(change.ToHTMLString())
-		if err != nil {
-			slog.Error("Failed to send change message", "error", err)
-		}
+	select {
+	case b.syncSem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil
+	defer func() { <-b.syncSem }()
+
+	syncCtx, cancel := context.WithTimeout(ctx, b.syncTimeout)
+	defer cancel()
+
+	changes, err := svc.ParseAndCompare(syncCtx)
+
+	// Delivery failures are logged by the notifiers.
+	if len(changes) > 0 || err == nil {
+		b.notifierFor(chatID).Notify(changes)
+	}
+
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		// Shutting down, nobody to tell.
+		slog.Warn("Sync aborted", "chat", chatID, "error", err)
+	case errors.Is(syncCtx.Err(), context.DeadlineExceeded):
+		slog.Error("Sync timed out", "chat", chatID, "timeout", b.syncTimeout, "changes", len(changes))
+		b.Send(chatID, fmt.Sprintf("⏱ Sync timed out after %s, Moodle is too slow. Changes found so far were sent, try /sync later.", b.syncTimeout))
+	default:
+		slog.Error("Failed to parse and compare", "chat", chatID, "error", err)
+		b.Send(chatID, escape(err.Error()))
+	}
+	return err
 }
 
-func (b *TelegramBot) HandleManualSync() error {
-	err := b.SendToTarget("Manual sync triggered")
+func (b *TelegramBot) HandleManualSync(ctx context.Context, chatID int64) error {
+	if _, ok := b.userService(chatID); !ok {
+		return users.ErrNotRegistered
+	}
+
+	err := b.Send(chatID, "Manual sync triggered")
 	if err != nil {
 		slog.Error("Failed to send sync message", "error", err)
 		return err
 	}
 
-	err = b.HandleSync()
+	err = b.syncUser(ctx, chatID)
 	if err != nil {
 		slog.Error("Manual sync failed", "error", err)
 		return err
 	}
 
-	err = b.SendToTarget("Manual sync finished")
+	err = b.Send(chatID, "Manual sync finished")
 	if err != nil {
 		slog.Error("Failed to send sync message", "error", err)
 		return err
@@ -68,33 +144,113 @@ func (b *TelegramBot) HandleManualSync() error {
 	return nil
 }
 
-func (b *TelegramBot) HandlerStatus() {
-	msg := fmt.Sprintf("Last parsed at: %s", b.gradeService.LastTimeParsed.Format("2006-01-02 15:04:05"))
-	err := b.SendToTarget(msg)
+func (b *TelegramBot) HandlerStatus(chatID int64) {
+	svc, ok := b.userService(chatID)
+	if !ok {
+		return
+	}
+
+	msg := fmt.Sprintf("Last parsed at: %s", svc.LastTimeParsed.Format("2006-01-02 15:04:05"))
+	err := b.Send(chatID, msg)
 	if err != nil {
 		slog.Error("Failed to send status", "error", err)
 	}
 }
 
-func (b *TelegramBot) HandleList() {
-	courseNames, err := b.gradeService.GetCourseNamesList()
+func (b *TelegramBot) HandleList(chatID int64) {
+	svc, ok := b.userService(chatID)
+	if !ok {
+		return
+	}
+
+	courses, err := svc.GetCourses()
 	if err != nil {
 		slog.Error("Failed to get course names", "error", err)
-		b.SendError("Failed to get course names")
+		b.SendError(chatID, "Failed to get course names")
 		return
 	}
 
-	slog.Debug("Sending course list", "courses", courseNames)
+	slog.Debug("Sending course list", "courses", len(courses))
 	var keyboard [][]tapi.InlineKeyboardButton
-	for _, courseName := range courseNames {
+	for _, course := range courses {
 		keyboard = append(keyboard, []tapi.InlineKeyboardButton{
-			tapi.NewInlineKeyboardButtonData(courseName, "crs:"+utils.Compress(courseName)),
+			tapi.NewInlineKeyboardButtonData(course.Name, "crs:"+callbackCourseID(course.ID)),
 		})
 	}
 
-	err = b.SendToTargetWithKeyboard("Available courses:", keyboard)
+	err = b.SendMessageWithKeyboard(chatID, "Available courses:", keyboard)
 	if err != nil {
 		slog.Error("Failed to send course list", "error", err)
-		b.SendError("Failed to send course list")
+		b.SendError(chatID, "Failed to send course list")
+	}
+}
+
+// callbackCourseID keeps callback data within Telegram's 64 byte limit for
+// courses that are still keyed by their name.
+func callbackCourseID(id string) string {
+	if len(id) <= 56 {
+		return id
+	}
+	return utils.Compress(id)
+}
+
+func (b *TelegramBot) HandleHistory(chatID int64, courseQuery string) {
+	svc, ok := b.userService(chatID)
+	if !ok {
+		return
+	}
+
+	courseQuery = strings.TrimSpace(courseQuery)
+	if courseQuery == "" {
+		b.SendError(chatID, "Usage: /history <course>")
+		return
+	}
+
+	course, events, err := svc.GetHistory(courseQuery)
+	if errors.Is(err, service.ErrCourseNotFound) || errors.Is(err, service.ErrAmbiguousCourse) {
+		b.Send(chatID, escape(err.Error()))
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to get grade history", "course", courseQuery, "error", err)
+		b.SendError(chatID, "Failed to get grade history")
+		return
+	}
+
+	if len(events) == 0 {
+		b.SendError(chatID, "No history found for "+course.Name)
+		return
+	}
+
+	// Events keep the course name of their time; the course is shown under
+	// its current name.
+	var order []string
+	byItem := map[string][]model.GradeEvent{}
+	for _, ev := range events {
+		if _, ok := byItem[ev.ItemName]; !ok {
+			order = append(order, ev.ItemName)
+		}
+		byItem[ev.ItemName] = append(byItem[ev.ItemName], ev)
+	}
+
+	var mb MessageBuilder
+	mb.Linef("<b>%s</b>", course.Name)
+	for _, item := range order {
+		mb.Linef("%s", item)
+		for _, ev := range byItem[item] {
+			at := ev.ObservedAt.Format("2006-01-02 15:04")
+			switch ev.TP {
+			case model.Removed:
+				mb.Linef("  %s 🚫 removed", at)
+			default:
+				mb.Linef("  %s %s", at, ev.New.StringWithoutName())
+			}
+		}
+	}
+
+	err = b.Send(chatID, mb.String())
+	if err != nil {
+		slog.Error("Failed to send grade history", "error", err)
+		b.SendError(chatID, "Failed to send grade history for "+course.Name)
 	}
 }
@@ -0,0 +1,136 @@
+package telegram
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/users"
+	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type loginStep int
+
+const (
+	loginAwaitUser loginStep = iota
+	loginAwaitPass
+)
+
+// loginState is the /login conversation of a single chat.
+type loginState struct {
+	step     loginStep
+	username string
+}
+
+func (b *TelegramBot) HandleLogin(chatID int64) {
+	if b.users.IsOwner(chatID) {
+		b.SendError(chatID, "The owner account is configured in .env")
+		return
+	}
+
+	b.loginMux.Lock()
+	b.logins[chatID] = &loginState{step: loginAwaitUser}
+	b.loginMux.Unlock()
+
+	err := b.Send(chatID, "Send your Moodle username (or /cancel)")
+	if err != nil {
+		slog.Error("Failed to send login prompt", "error", err)
+	}
+}
+
+func (b *TelegramBot) HandleCancel(chatID int64) {
+	b.loginMux.Lock()
+	_, ok := b.logins[chatID]
+	delete(b.logins, chatID)
+	b.loginMux.Unlock()
+
+	whatIf := b.clearWhatIf(chatID)
+
+	msg := ""
+	switch {
+	case ok:
+		msg = "Login cancelled"
+	case whatIf:
+		msg = "What-if cancelled"
+	default:
+		return
+	}
+	err := b.Send(chatID, msg)
+	if err != nil {
+		slog.Error("Failed to send cancel message", "error", err)
+	}
+}
+
+func (b *TelegramBot) HandleLogout(chatID int64) {
+	err := b.users.Unregister(chatID)
+	if err != nil {
+		b.Send(chatID, escape(err.Error()))
+		return
+	}
+
+	err = b.Send(chatID, "Your Moodle account was removed. Stored grades are kept until you /login again.")
+	if err != nil {
+		slog.Error("Failed to send logout message", "error", err)
+	}
+}
+
+// HandleConversation handles plain text messages, which are only expected
+// as answers during /login or to the what-if prompt.
+func (b *TelegramBot) HandleConversation(ctx context.Context, msg tapi.Message) {
+	chatID := msg.Chat.ID
+	if b.handleWhatIfAnswer(chatID, strings.TrimSpace(msg.Text)) {
+		return
+	}
+
+	b.loginMux.Lock()
+	state, ok := b.logins[chatID]
+	if !ok {
+		b.loginMux.Unlock()
+		return
+	}
+
+	text := strings.TrimSpace(msg.Text)
+	switch state.step {
+	case loginAwaitUser:
+		state.username = text
+		state.step = loginAwaitPass
+		b.loginMux.Unlock()
+
+		err := b.Send(chatID, "Send your Moodle password. The message will be deleted right away.")
+		if err != nil {
+			slog.Error("Failed to send login prompt", "error", err)
+		}
+		return
+	case loginAwaitPass:
+		delete(b.logins, chatID)
+		b.loginMux.Unlock()
+	}
+
+	_, err := b.bot.Request(tapi.NewDeleteMessage(chatID, msg.MessageID))
+	if err != nil {
+		slog.Warn("Failed to delete password message", "chat", chatID, "error", err)
+	}
+
+	b.background(func() { b.register(ctx, chatID, state.username, text) })
+}
+
+// register checks the credentials with Moodle, which may take a while with
+// retries, and tells the chat how it went.
+func (b *TelegramBot) register(ctx context.Context, chatID int64, username, password string) {
+	err := b.users.Register(ctx, users.User{
+		ChatID:     chatID,
+		MoodleUser: username,
+		MoodlePass: password,
+	})
+	if err != nil {
+		slog.Warn("Login failed", "chat", chatID, "error", err)
+		b.Send(chatID, escape(err.Error()))
+		return
+	}
+
+	slog.Info("User registered", "chat", chatID)
+	err = b.Send(chatID, "✅ Logged in. The first /sync stores your current grades, later syncs report changes.")
+	if err != nil {
+		slog.Error("Failed to send login message", "error", err)
+	}
+}
@@ -0,0 +1,182 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+
+	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxMessageLen is Telegram's limit on the text of a message, in UTF-16 code units.
+const maxMessageLen = 4096
+
+var (
+	tagPattern   = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9-]*)[^>]*>`)
+	tokenPattern = regexp.MustCompile(`(?s)<[^>]*>|&[a-zA-Z0-9#]+;|.`)
+)
+
+// escape makes user content such as course names and feedback safe inside
+// an HTML message.
+func escape(s string) string {
+	return html.EscapeString(s)
+}
+
+// plainText strips the markup of an HTML message.
+func plainText(msg string) string {
+	return html.UnescapeString(tagPattern.ReplaceAllString(msg, ""))
+}
+
+// MessageBuilder builds an HTML message line by line. Formats are trusted
+// markup, string arguments are escaped.
+type MessageBuilder struct {
+	sb strings.Builder
+}
+
+// Line appends trusted markup and a line break.
+func (m *MessageBuilder) Line(markup string) {
+	m.sb.WriteString(markup)
+	m.sb.WriteString("\n")
+}
+
+// Linef appends a formatted line, escaping string and fmt.Stringer arguments.
+func (m *MessageBuilder) Linef(format string, args ...any) {
+	escaped := make([]any, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			escaped[i] = escape(v)
+		case fmt.Stringer:
+			escaped[i] = escape(v.String())
+		default:
+			escaped[i] = arg
+		}
+	}
+	m.Line(fmt.Sprintf(format, escaped...))
+}
+
+func (m *MessageBuilder) String() string {
+	return strings.TrimRight(m.sb.String(), "\n")
+}
+
+func textLen(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+type openTag struct {
+	name   string
+	markup string
+}
+
+// messageSplitter cuts an HTML message into parts that fit in one message.
+// Tags still open at a cut are closed at the end of the part and opened again
+// at the start of the next one.
+type messageSplitter struct {
+	limit      int
+	parts      []string
+	cur        strings.Builder
+	curLen     int
+	hasContent bool
+	open       []openTag
+}
+
+func splitMessage(msg string, limit int) []string {
+	s := &messageSplitter{limit: limit}
+
+	for line := range strings.SplitAfterSeq(msg, "\n") {
+		if s.fits(line) {
+			s.add(line)
+			continue
+		}
+		if s.hasContent {
+			s.flush()
+		}
+		if s.fits(line) {
+			s.add(line)
+			continue
+		}
+
+		// A single line longer than a message is cut between characters,
+		// never inside a tag or an entity.
+		for _, token := range tokenPattern.FindAllString(line, -1) {
+			if !s.fits(token) && s.hasContent {
+				s.flush()
+			}
+			s.add(token)
+		}
+	}
+	if s.hasContent {
+		s.flush()
+	}
+
+	return s.parts
+}
+
+func (s *messageSplitter) fits(segment string) bool {
+	return s.curLen+textLen(segment)+textLen(closingTags(updateTags(s.open, segment))) <= s.limit
+}
+
+func (s *messageSplitter) add(segment string) {
+	s.cur.WriteString(segment)
+	s.curLen += textLen(segment)
+	s.open = updateTags(s.open, segment)
+	if strings.TrimSpace(tagPattern.ReplaceAllString(segment, "")) != "" {
+		s.hasContent = true
+	}
+}
+
+func (s *messageSplitter) flush() {
+	s.parts = append(s.parts, strings.TrimRight(s.cur.String(), "\n")+closingTags(s.open))
+
+	s.cur.Reset()
+	for _, tag := range s.open {
+		s.cur.WriteString(tag.markup)
+	}
+	s.curLen = textLen(s.cur.String())
+	s.hasContent = false
+}
+
+// updateTags returns the tags open after the segment.
+func updateTags(open []openTag, segment string) []openTag {
+	matches := tagPattern.FindAllStringSubmatch(segment, -1)
+	if len(matches) == 0 {
+		return open
+	}
+
+	out := append([]openTag(nil), open...)
+	for _, m := range matches {
+		name := strings.ToLower(m[2])
+		if m[1] == "" {
+			out = append(out, openTag{name: name, markup: m[0]})
+			continue
+		}
+		for i := len(out) - 1; i >= 0; i-- {
+			if out[i].name == name {
+				out = append(out[:i], out[i+1:]...)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func closingTags(open []openTag) string {
+	var sb strings.Builder
+	for i := len(open) - 1; i >= 0; i-- {
+		sb.WriteString("</" + open[i].name + ">")
+	}
+	return sb.String()
+}
+
+// isParseError reports whether Telegram rejected the HTML of a message.
+func isParseError(err error) bool {
+	var apiErr *tapi.Error
+	return errors.As(err, &apiErr) && strings.Contains(apiErr.Message, "can't parse entities")
+}
@@ -0,0 +1,90 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+
+	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageBuilder(t *testing.T) {
+	var mb MessageBuilder
+	mb.Linef("<b>%s</b> (%d)", "Physics <Lab> & Co", 3)
+	mb.Line("<i>done</i>")
+
+	assert.Equal(t, "<b>Physics &lt;Lab&gt; &amp; Co</b> (3)\n<i>done</i>", mb.String())
+}
+
+func TestSplitMessage(t *testing.T) {
+	testcases := []struct {
+		name     string
+		msg      string
+		limit    int
+		expected []string
+	}{
+		{name: "short", msg: "hello\nworld", limit: 20, expected: []string{"hello\nworld"}},
+		{name: "empty", msg: "", limit: 20},
+		{name: "line boundaries", msg: "aaaa\nbbbb\ncccc", limit: 10, expected: []string{"aaaa\nbbbb", "cccc"}},
+		{
+			name:     "reopens tags",
+			msg:      "<b>title\nline one\nline two</b>",
+			limit:    24,
+			expected: []string{"<b>title\nline one</b>", "<b>line two</b>"},
+		},
+		{
+			name:     "long line keeps entities",
+			msg:      "abc&amp;defgh",
+			limit:    6,
+			expected: []string{"abc", "&amp;d", "efgh"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			parts := splitMessage(tc.msg, tc.limit)
+			assert.Equal(t, tc.expected, parts)
+			for _, p := range parts {
+				assert.LessOrEqual(t, textLen(p), tc.limit, p)
+			}
+		})
+	}
+}
+
+func TestSend_LongMessage(t *testing.T) {
+	bot, api := newTestBot(t)
+
+	var mb MessageBuilder
+	for i := range 300 {
+		mb.Linef("<i>%d</i>. %s", i, strings.Repeat("x", 30))
+	}
+	require.NoError(t, bot.Send(ownerID, mb.String()))
+	flush(t, bot)
+
+	sent := api.Sent()
+	require.Greater(t, len(sent), 1)
+	var texts []string
+	for _, msg := range sent {
+		assert.LessOrEqual(t, textLen(msg.Text), maxMessageLen)
+		texts = append(texts, msg.Text)
+	}
+	assert.Equal(t, mb.String(), strings.Join(texts, "\n"))
+}
+
+func TestSend_PlainTextFallback(t *testing.T) {
+	bot, api := newTestBot(t)
+	api.OnSend = func(c tapi.Chattable) error {
+		if m, ok := c.(tapi.MessageConfig); ok && m.ParseMode == tapi.ModeHTML {
+			return &tapi.Error{Code: 400, Message: "Bad Request: can't parse entities: unsupported start tag"}
+		}
+		return nil
+	}
+
+	require.NoError(t, bot.Send(ownerID, "<b>Score</b> 5 <unknown> &amp; more"))
+	flush(t, bot)
+
+	sent := api.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "Score 5  & more", sent[0].Text)
+}
@@ -0,0 +1,145 @@
+package telegram
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/notify"
+)
+
+// ChatNotifier sends changes to one chat, as a message per change or as
+// digests depending on TELEGRAM_NOTIFY_MODE.
+type ChatNotifier struct {
+	bot    *TelegramBot
+	chatID int64
+	mode   string
+}
+
+func (b *TelegramBot) NewChatNotifier(chatID int64) *ChatNotifier {
+	return &ChatNotifier{bot: b, chatID: chatID, mode: b.notifyMode}
+}
+
+func (n *ChatNotifier) Notify(changes []model.Change) error {
+	var messages []string
+	switch n.mode {
+	case config.NotifyModeInstant:
+		for _, change := range changes {
+			msg := change.ToHTMLString()
+			if change.Standing != nil {
+				msg += "\n" + standingLine(*change.Standing)
+			}
+			messages = append(messages, msg)
+		}
+	case config.NotifyModeSync:
+		messages = append(messages, syncDigest(fmt.Sprintf("🔔 %d change(s)", len(changes)), changes))
+	default:
+		for _, group := range model.GroupByCourse(changes) {
+			messages = append(messages, courseDigest(group))
+		}
+	}
+
+	var errs []error
+	for _, msg := range messages {
+		err := n.bot.Send(n.chatID, msg)
+		if err != nil {
+			slog.Error("Failed to send change message", "chat", n.chatID, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NotifyBatch sends all changes as one message.
+func (n *ChatNotifier) NotifyBatch(changes []model.Change) error {
+	return n.bot.Send(n.chatID, syncDigest(fmt.Sprintf("🌙 %d change(s) while you were away", len(changes)), changes))
+}
+
+// courseDigest renders the changes of one course under a summary line.
+func courseDigest(changes []model.Change) string {
+	var mb MessageBuilder
+	writeCourseSection(&mb, changes)
+	return mb.String()
+}
+
+// syncDigest renders changes of any number of courses under a title and a
+// summary line, a section per course.
+func syncDigest(title string, changes []model.Change) string {
+	groups := model.GroupByCourse(changes)
+
+	var mb MessageBuilder
+	mb.Line(title)
+	mb.Linef("%d course(s): %s", len(groups), model.Summary(changes))
+	for _, group := range groups {
+		mb.Line("")
+		writeCourseSection(&mb, group)
+	}
+	return mb.String()
+}
+
+func writeCourseSection(mb *MessageBuilder, changes []model.Change) {
+	mb.Linef("📚 <b>%s</b>: %s", changes[0].CourseName, model.Summary(changes))
+	for _, change := range changes {
+		mb.Line("")
+		mb.Line(change.DetailsHTML())
+	}
+	if st := changes[len(changes)-1].Standing; st != nil {
+		mb.Line("")
+		mb.Line(standingLine(*st))
+	}
+}
+
+// standingLine renders the course standing, e.g. "📊 Current: 82.5%, 40%
+// of the course graded, 33% earned".
+func standingLine(st model.Standing) string {
+	var mb MessageBuilder
+	switch {
+	case st.Graded > 0 && st.Reported.IsGraded():
+		mb.Linef("📊 Current: <b>%s%%</b>, %s%% of the course graded, %s%% earned (Moodle total: %s%%)",
+			model.FormatNumber(st.Current), model.FormatNumber(st.Graded), model.FormatNumber(st.Earned), st.Reported)
+	case st.Graded > 0:
+		mb.Linef("📊 Current: <b>%s%%</b>, %s%% of the course graded, %s%% earned",
+			model.FormatNumber(st.Current), model.FormatNumber(st.Graded), model.FormatNumber(st.Earned))
+	default:
+		mb.Linef("📊 Moodle total: <b>%s%%</b>", st.Reported)
+	}
+	return mb.String()
+}
+
+// notifierFor returns where the changes of a chat go: the chat itself and,
+// for the owner, the channels from the config, held back during quiet hours.
+// Notifiers are cached since quiet hours keep state per chat.
+func (b *TelegramBot) notifierFor(chatID int64) notify.Notifier {
+	b.notifiersMux.Lock()
+	defer b.notifiersMux.Unlock()
+
+	if n, ok := b.notifiers[chatID]; ok {
+		return n
+	}
+
+	fanout := notify.Fanout{b.NewChatNotifier(chatID)}
+	if chatID == b.targetID {
+		fanout = append(fanout, b.ownerNotifiers...)
+	}
+
+	var n notify.Notifier = fanout
+	if !b.quietHours.IsZero() {
+		n = notify.NewQuietHours(fanout, b.quietHours, b.heldChanges, strconv.FormatInt(chatID, 10))
+	}
+	b.notifiers[chatID] = n
+	return n
+}
+
+// restoreHeldChanges sets up the notifiers of every chat, so changes held
+// back before a restart are delivered when their quiet hours end.
+func (b *TelegramBot) restoreHeldChanges() {
+	if b.quietHours.IsZero() {
+		return
+	}
+	for _, chatID := range b.users.ChatIDs() {
+		b.notifierFor(chatID)
+	}
+}
@@ -0,0 +1,111 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatNotifier_Modes(t *testing.T) {
+	quiz := func(name, grade string) *model.GradeRow {
+		return model.NewGradeRow([]string{name, "10.00 %", grade, "0–10", grade + "0.00 %"})
+	}
+	changes := []model.Change{
+		{TP: model.NewElement, CourseID: "101", CourseName: "Calculus II", New: quiz("Quiz 1", "8")},
+		{TP: model.NewElement, CourseID: "202", CourseName: "Discrete <Math>", New: quiz("Homework 1", "9")},
+		{TP: model.Changed, CourseID: "101", CourseName: "Calculus II", Old: quiz("Quiz 2", "5"), New: quiz("Quiz 2", "7")},
+	}
+
+	testcases := []struct {
+		name     string
+		mode     string
+		expected []string
+	}{
+		{
+			name: "instant",
+			mode: config.NotifyModeInstant,
+			expected: []string{
+				changes[0].ToHTMLString(),
+				changes[1].ToHTMLString(),
+				changes[2].ToHTMLString(),
+			},
+		},
+		{
+			name: "course",
+			mode: config.NotifyModeCourse,
+			expected: []string{
+				"📚 <b>Calculus II</b>: 1 new, 1 changed\n\n" + changes[0].DetailsHTML() + "\n\n" + changes[2].DetailsHTML(),
+				"📚 <b>Discrete &lt;Math&gt;</b>: 1 new\n\n" + changes[1].DetailsHTML(),
+			},
+		},
+		{
+			name: "sync",
+			mode: config.NotifyModeSync,
+			expected: []string{
+				"🔔 3 change(s)\n2 course(s): 2 new, 1 changed\n\n" +
+					"📚 <b>Calculus II</b>: 1 new, 1 changed\n\n" + changes[0].DetailsHTML() + "\n\n" + changes[2].DetailsHTML() + "\n\n" +
+					"📚 <b>Discrete &lt;Math&gt;</b>: 1 new\n\n" + changes[1].DetailsHTML(),
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			bot, api := newTestBot(t)
+			bot.notifyMode = tc.mode
+
+			require.NoError(t, bot.NewChatNotifier(ownerID).Notify(changes))
+			flush(t, bot)
+
+			sent := api.Sent()
+			require.Len(t, sent, len(tc.expected))
+			for i, msg := range sent {
+				assert.Equal(t, ownerID, msg.ChatID)
+				assert.Equal(t, tc.expected[i], msg.Text)
+			}
+		})
+	}
+}
+
+func TestChatNotifier_NotifyBatch(t *testing.T) {
+	bot, api := newTestBot(t)
+	change := model.Change{
+		TP: model.Removed, CourseID: "101", CourseName: "Calculus II",
+		Old: model.NewGradeRow([]string{"Quiz 1", "10.00 %", "8.00", "0–10", "80.00 %"}),
+	}
+
+	require.NoError(t, bot.NewChatNotifier(ownerID).NotifyBatch([]model.Change{change}))
+	flush(t, bot)
+
+	sent := api.Sent()
+	require.Len(t, sent, 1)
+	assert.Equal(t, "🌙 1 change(s) while you were away\n1 course(s): 1 removed\n\n"+
+		"📚 <b>Calculus II</b>: 1 removed\n\n"+change.DetailsHTML(), sent[0].Text)
+}
+
+func TestChatNotifier_Standing(t *testing.T) {
+	standing := &model.Standing{Current: 75, Earned: 60, Graded: 80, Reported: model.ParseGradeValue("78.00 %")}
+	change := model.Change{
+		TP: model.NewElement, CourseID: "101", CourseName: "Calculus II",
+		New:      model.NewGradeRow([]string{"Quiz 1", "10.00 %", "8.00", "0–10", "80.00 %"}),
+		Standing: standing,
+	}
+	line := "📊 Current: <b>75%</b>, 80% of the course graded, 60% earned (Moodle total: 78%)"
+
+	for _, mode := range []string{config.NotifyModeInstant, config.NotifyModeCourse, config.NotifyModeSync} {
+		t.Run(mode, func(t *testing.T) {
+			bot, api := newTestBot(t)
+			bot.notifyMode = mode
+
+			require.NoError(t, bot.NewChatNotifier(ownerID).Notify([]model.Change{change}))
+			flush(t, bot)
+
+			sent := api.Sent()
+			require.Len(t, sent, 1)
+			assert.Contains(t, sent[0].Text, line)
+		})
+	}
+}
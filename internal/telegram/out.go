@@ -6,10 +6,41 @@ import (
 	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
+// Send queues an HTML message, split into several when it is too long. It
+// only fails when the queue can't be saved.
 func (b *TelegramBot) Send(chatID int64, msg string) error {
-	message := tapi.NewMessage(chatID, msg)
-	message.ParseMode = tapi.ModeHTML
-	_, err := b.bot.Send(message)
+	return b.queue.Enqueue(chatID, msg, nil)
+}
+
+// SendDocument queues a file with a plain text caption.
+func (b *TelegramBot) SendDocument(chatID int64, name string, data []byte, caption string) error {
+	return b.queue.EnqueueDocument(chatID, name, data, caption)
+}
+
+// sendNow sends an HTML message right away, bypassing the queue.
+func (b *TelegramBot) sendNow(chatID int64, msg string) error {
+	for _, part := range splitMessage(msg, maxMessageLen) {
+		message := tapi.NewMessage(chatID, part)
+		message.ParseMode = tapi.ModeHTML
+		if err := sendWithFallback(b.bot, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendWithFallback resends a message Telegram could not parse as plain text,
+// so broken markup does not lose the message.
+func sendWithFallback(api BotAPI, message tapi.MessageConfig) error {
+	_, err := api.Send(message)
+	if err == nil || !isParseError(err) {
+		return err
+	}
+
+	slog.Warn("Telegram rejected message markup, sending plain text", "chat", message.ChatID, "error", err)
+	message.Text = plainText(message.Text)
+	message.ParseMode = ""
+	_, err = api.Send(message)
 	return err
 }
 
@@ -24,27 +55,25 @@ func (b *TelegramBot) StartMessage() {
 	}
 }
 
+// DeadMessage is sent directly, the queue worker is already stopped.
 func (b *TelegramBot) DeadMessage() {
-	err := b.SendToTarget("☠️ Bot shutting down")
+	err := b.sendNow(b.targetID, "☠️ Bot shutting down")
 	if err != nil {
 		slog.Error("Failed to send shutdown message", "error", err)
 	}
 }
 
 func (b *TelegramBot) SendMessageWithKeyboard(chatID int64, msg string, inlineKeyboard [][]tapi.InlineKeyboardButton) error {
-	message := tapi.NewMessage(chatID, msg)
-	message.ParseMode = tapi.ModeHTML
-	message.ReplyMarkup = tapi.NewInlineKeyboardMarkup(inlineKeyboard...)
-	_, err := b.bot.Send(message)
-	return err
+	return b.queue.Enqueue(chatID, msg, inlineKeyboard)
 }
 
 func (b *TelegramBot) SendToTargetWithKeyboard(msg string, inlineKeyboard [][]tapi.InlineKeyboardButton) error {
 	return b.SendMessageWithKeyboard(b.targetID, msg, inlineKeyboard)
 }
 
-func (b *TelegramBot) SendError(msg string) {
-	err := b.SendToTarget("❗️ " + msg)
+// SendError sends a plain text error; msg is escaped.
+func (b *TelegramBot) SendError(chatID int64, msg string) {
+	err := b.Send(chatID, "❗️ "+escape(msg))
 	if err != nil {
 		slog.Error("Failed to send error message", "error", err)
 	}
@@ -0,0 +1,307 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// defaultGlobalInterval keeps the bot under Telegram's limit of about 30
+	// messages per second overall.
+	defaultGlobalInterval = time.Second / 30
+	maxSendBackoff        = 5 * time.Minute
+)
+
+// queuedMessage is one message part waiting to be sent. A message with a
+// Document sends the file with Text as its caption.
+type queuedMessage struct {
+	ID        uint64                        `json:"id"`
+	ChatID    int64                         `json:"chat_id"`
+	Text      string                        `json:"text"`
+	Keyboard  [][]tapi.InlineKeyboardButton `json:"keyboard,omitempty"`
+	Document  *queuedDocument               `json:"document,omitempty"`
+	Attempts  int                           `json:"attempts,omitempty"`
+	NotBefore time.Time                     `json:"not_before,omitzero"`
+}
+
+// queuedDocument is a file to send, kept in the queue file as base64.
+type queuedDocument struct {
+	Name  string `json:"name"`
+	Bytes []byte `json:"bytes"`
+}
+
+// SendQueue delivers outgoing messages one at a time. It keeps the order per
+// chat, paces messages to the same chat, waits out Telegram's retry_after
+// and retries failed sends. Pending messages are persisted, so a restart
+// does not lose them.
+type SendQueue struct {
+	api            BotAPI
+	path           string
+	chatInterval   time.Duration
+	globalInterval time.Duration
+
+	mux         sync.Mutex
+	nextID      uint64
+	pending     []queuedMessage
+	lastSent    map[int64]time.Time
+	lastAny     time.Time
+	pausedUntil time.Time
+
+	wake chan struct{}
+}
+
+// NewSendQueue loads the messages left in path; an empty path keeps the
+// queue in memory only.
+func NewSendQueue(api BotAPI, path string, chatInterval time.Duration) (*SendQueue, error) {
+	q := &SendQueue{
+		api:            api,
+		path:           path,
+		chatInterval:   chatInterval,
+		globalInterval: defaultGlobalInterval,
+		lastSent:       map[int64]time.Time{},
+		wake:           make(chan struct{}, 1),
+	}
+	if path == "" {
+		return q, nil
+	}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read send queue: %v", err)
+	}
+	if err := json.Unmarshal(buf, &q.pending); err != nil {
+		return nil, fmt.Errorf("failed to parse send queue: %v", err)
+	}
+	for _, msg := range q.pending {
+		q.nextID = max(q.nextID, msg.ID)
+	}
+	if len(q.pending) > 0 {
+		slog.Info("Loaded pending messages", "count", len(q.pending))
+	}
+
+	return q, nil
+}
+
+// Enqueue splits an HTML message into parts and queues them; the keyboard
+// goes with the last part.
+func (q *SendQueue) Enqueue(chatID int64, msg string, inlineKeyboard [][]tapi.InlineKeyboardButton) error {
+	parts := splitMessage(msg, maxMessageLen)
+	if len(parts) == 0 {
+		return nil
+	}
+
+	q.mux.Lock()
+	for i, part := range parts {
+		q.nextID++
+		m := queuedMessage{ID: q.nextID, ChatID: chatID, Text: part}
+		if i == len(parts)-1 {
+			m.Keyboard = inlineKeyboard
+		}
+		q.pending = append(q.pending, m)
+	}
+	err := q.save()
+	q.mux.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// EnqueueDocument queues a file with a plain text caption, in order with the
+// messages of the chat.
+func (q *SendQueue) EnqueueDocument(chatID int64, name string, data []byte, caption string) error {
+	q.mux.Lock()
+	q.nextID++
+	q.pending = append(q.pending, queuedMessage{
+		ID:       q.nextID,
+		ChatID:   chatID,
+		Text:     caption,
+		Document: &queuedDocument{Name: name, Bytes: data},
+	})
+	err := q.save()
+	q.mux.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return err
+}
+
+// Len returns the number of queued message parts.
+func (q *SendQueue) Len() int {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+	return len(q.pending)
+}
+
+// Run delivers messages until ctx is done.
+func (q *SendQueue) Run(ctx context.Context) {
+	for {
+		wait, pending := q.step()
+		if pending && wait == 0 {
+			continue
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if pending {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-q.wake:
+		case <-timeout:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// step sends at most one message. It returns how long to wait before the
+// next message may go out, and false when the queue is empty.
+func (q *SendQueue) step() (time.Duration, bool) {
+	q.mux.Lock()
+	if len(q.pending) == 0 {
+		q.mux.Unlock()
+		return 0, false
+	}
+	now := time.Now()
+	if now.Before(q.pausedUntil) {
+		q.mux.Unlock()
+		return q.pausedUntil.Sub(now), true
+	}
+	idx, wait := q.nextReady(now)
+	if idx < 0 {
+		q.mux.Unlock()
+		return wait, true
+	}
+	msg := q.pending[idx]
+	q.mux.Unlock()
+
+	err := q.deliver(msg)
+
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	now = time.Now()
+	q.lastSent[msg.ChatID] = now
+	q.lastAny = now
+
+	idx = slices.IndexFunc(q.pending, func(m queuedMessage) bool { return m.ID == msg.ID })
+	var apiErr *tapi.Error
+	switch {
+	case err == nil:
+		q.pending = slices.Delete(q.pending, idx, idx+1)
+	case errors.As(err, &apiErr) && apiErr.RetryAfter > 0:
+		// The limit applies to the whole bot, so every chat waits.
+		q.pausedUntil = now.Add(time.Duration(apiErr.RetryAfter) * time.Second)
+		slog.Warn("Telegram rate limit hit, pausing sends", "retry_after", apiErr.RetryAfter, "pending", len(q.pending))
+	case errors.As(err, &apiErr) && apiErr.Code >= 400 && apiErr.Code < 500:
+		// Chat not found, bot blocked and the like won't get better.
+		slog.Error("Dropping message Telegram refused", "chat", msg.ChatID, "error", err)
+		q.pending = slices.Delete(q.pending, idx, idx+1)
+	default:
+		q.pending[idx].Attempts++
+		delay := min(time.Second<<min(q.pending[idx].Attempts, 10), maxSendBackoff)
+		q.pending[idx].NotBefore = now.Add(delay)
+		slog.Warn("Failed to send message, will retry", "chat", msg.ChatID, "attempt", q.pending[idx].Attempts, "delay", delay, "error", err)
+	}
+
+	if err := q.save(); err != nil {
+		slog.Error("Failed to save send queue", "error", err)
+	}
+	return 0, true
+}
+
+// nextReady returns the index of the first message that may be sent now.
+// Only the oldest message of each chat is considered, to keep the order.
+// Otherwise it returns -1 and the time until one becomes ready.
+func (q *SendQueue) nextReady(now time.Time) (int, time.Duration) {
+	seen := map[int64]bool{}
+	wait := time.Duration(-1)
+	for i, msg := range q.pending {
+		if seen[msg.ChatID] {
+			continue
+		}
+		seen[msg.ChatID] = true
+
+		ready := msg.NotBefore
+		if last, ok := q.lastSent[msg.ChatID]; ok {
+			ready = later(ready, last.Add(q.chatInterval))
+		}
+		ready = later(ready, q.lastAny.Add(q.globalInterval))
+
+		if !ready.After(now) {
+			return i, 0
+		}
+		if d := ready.Sub(now); wait < 0 || d < wait {
+			wait = d
+		}
+	}
+	return -1, wait
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func (q *SendQueue) deliver(msg queuedMessage) error {
+	if msg.Document != nil {
+		doc := tapi.NewDocument(msg.ChatID, tapi.FileBytes{Name: msg.Document.Name, Bytes: msg.Document.Bytes})
+		doc.Caption = msg.Text
+		_, err := q.api.Send(doc)
+		return err
+	}
+
+	message := tapi.NewMessage(msg.ChatID, msg.Text)
+	message.ParseMode = tapi.ModeHTML
+	if msg.Keyboard != nil {
+		message.ReplyMarkup = tapi.NewInlineKeyboardMarkup(msg.Keyboard...)
+	}
+	return sendWithFallback(q.api, message)
+}
+
+func (q *SendQueue) save() error {
+	if q.path == "" {
+		return nil
+	}
+
+	buf, err := json.Marshal(q.pending)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return err
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
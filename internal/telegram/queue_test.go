@@ -0,0 +1,189 @@
+package telegram
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/telegramtest"
+	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestQueue(t *testing.T, api BotAPI, path string) *SendQueue {
+	t.Helper()
+	q, err := NewSendQueue(api, path, 0)
+	require.NoError(t, err)
+	q.globalInterval = 0
+	return q
+}
+
+func sentTexts(api *telegramtest.FakeBot) []string {
+	var texts []string
+	for _, msg := range api.Sent() {
+		texts = append(texts, msg.Text)
+	}
+	return texts
+}
+
+func TestSendQueue_RetryAfter(t *testing.T) {
+	api := telegramtest.NewFakeBot()
+	limited := true
+	api.OnSend = func(c tapi.Chattable) error {
+		if limited {
+			return &tapi.Error{Code: 429, Message: "Too Many Requests: retry after 30", ResponseParameters: tapi.ResponseParameters{RetryAfter: 30}}
+		}
+		return nil
+	}
+	q := newTestQueue(t, api, "")
+
+	require.NoError(t, q.Enqueue(ownerID, "first", nil))
+	require.NoError(t, q.Enqueue(allowedID, "second", nil))
+
+	_, pending := q.step()
+	assert.True(t, pending)
+	assert.Equal(t, 2, q.Len())
+
+	// Every chat waits, not just the one that hit the limit.
+	wait, pending := q.step()
+	assert.True(t, pending)
+	assert.Greater(t, wait, 29*time.Second)
+	assert.Empty(t, api.Sent())
+
+	limited = false
+	q.pausedUntil = time.Time{}
+	flushQueue(t, q)
+	assert.Equal(t, []string{"first", "second"}, sentTexts(api))
+}
+
+func TestSendQueue_Retry(t *testing.T) {
+	api := telegramtest.NewFakeBot()
+	failures := 1
+	api.OnSend = func(c tapi.Chattable) error {
+		if failures > 0 {
+			failures--
+			return errors.New("connection reset by peer")
+		}
+		return nil
+	}
+	q := newTestQueue(t, api, "")
+
+	require.NoError(t, q.Enqueue(ownerID, "first", nil))
+	require.NoError(t, q.Enqueue(ownerID, "second", nil))
+
+	q.step()
+	require.Equal(t, 2, q.Len())
+	assert.Equal(t, 1, q.pending[0].Attempts)
+
+	// The next message of the chat waits for the failed one.
+	wait, pending := q.step()
+	assert.True(t, pending)
+	assert.Greater(t, wait, time.Duration(0))
+	assert.Empty(t, api.Sent())
+
+	q.pending[0].NotBefore = time.Time{}
+	flushQueue(t, q)
+	assert.Equal(t, []string{"first", "second"}, sentTexts(api))
+}
+
+func TestSendQueue_DropsRefused(t *testing.T) {
+	api := telegramtest.NewFakeBot()
+	api.OnSend = func(c tapi.Chattable) error {
+		if m, ok := c.(tapi.MessageConfig); ok && m.ChatID == strangeID {
+			return &tapi.Error{Code: 403, Message: "Forbidden: bot was blocked by the user"}
+		}
+		return nil
+	}
+	q := newTestQueue(t, api, "")
+
+	require.NoError(t, q.Enqueue(strangeID, "blocked", nil))
+	require.NoError(t, q.Enqueue(ownerID, "hello", nil))
+
+	flushQueue(t, q)
+	assert.Equal(t, []string{"hello"}, sentTexts(api))
+}
+
+func TestSendQueue_ChatInterval(t *testing.T) {
+	api := telegramtest.NewFakeBot()
+	q := newTestQueue(t, api, "")
+	q.chatInterval = time.Hour
+
+	require.NoError(t, q.Enqueue(ownerID, "first", nil))
+	require.NoError(t, q.Enqueue(ownerID, "second", nil))
+	require.NoError(t, q.Enqueue(allowedID, "other chat", nil))
+
+	q.step()
+	q.step()
+	wait, pending := q.step()
+	assert.True(t, pending)
+	assert.Greater(t, wait, 59*time.Minute)
+	assert.Equal(t, []string{"first", "other chat"}, sentTexts(api))
+}
+
+func TestSendQueue_Persisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	keyboard := [][]tapi.InlineKeyboardButton{{tapi.NewInlineKeyboardButtonData("Calculus II", "crs:101")}}
+
+	down := telegramtest.NewFakeBot()
+	down.OnSend = func(c tapi.Chattable) error { return errors.New("network is unreachable") }
+	q := newTestQueue(t, down, path)
+	require.NoError(t, q.Enqueue(ownerID, "first", nil))
+	require.NoError(t, q.Enqueue(ownerID, "second", keyboard))
+	q.step()
+
+	// After a restart the messages are still there, in order.
+	api := telegramtest.NewFakeBot()
+	q = newTestQueue(t, api, path)
+	require.Equal(t, 2, q.Len())
+	assert.Equal(t, 1, q.pending[0].Attempts)
+
+	q.pending[0].NotBefore = time.Time{}
+	flushQueue(t, q)
+	sent := api.Sent()
+	require.Len(t, sent, 2)
+	assert.Equal(t, "first", sent[0].Text)
+	assert.Equal(t, keyboard, sent[1].Keyboard)
+
+	require.NoError(t, q.Enqueue(ownerID, "third", nil))
+	q, err := NewSendQueue(api, path, 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, q.Len())
+	assert.Equal(t, uint64(3), q.pending[0].ID)
+}
+
+func TestSendQueue_Document(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+
+	q := newTestQueue(t, telegramtest.NewFakeBot(), path)
+	require.NoError(t, q.Enqueue(ownerID, "first", nil))
+	require.NoError(t, q.EnqueueDocument(ownerID, "gpa.csv", []byte("Course,Percent\n"), "GPA 3"))
+
+	// Documents survive a restart like messages do.
+	api := telegramtest.NewFakeBot()
+	q = newTestQueue(t, api, path)
+	require.Equal(t, 2, q.Len())
+	flushQueue(t, q)
+
+	assert.Equal(t, []string{"first"}, sentTexts(api))
+	requests := api.Requests()
+	require.Len(t, requests, 1)
+	doc, ok := requests[0].(tapi.DocumentConfig)
+	require.True(t, ok)
+	assert.Equal(t, ownerID, doc.ChatID)
+	assert.Equal(t, "GPA 3", doc.Caption)
+	assert.Equal(t, tapi.FileBytes{Name: "gpa.csv", Bytes: []byte("Course,Percent\n")}, doc.File)
+}
+
+func flushQueue(t *testing.T, q *SendQueue) {
+	t.Helper()
+	for range 100 {
+		wait, pending := q.step()
+		if !pending {
+			return
+		}
+		require.Zero(t, wait, "queue is waiting")
+	}
+	t.Fatalf("send queue not drained, %d messages left", q.Len())
+}
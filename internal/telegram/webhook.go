@@ -0,0 +1,128 @@
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookConfig is the TELEGRAM_WEBHOOK_* part of the config.
+type webhookConfig struct {
+	enabled  bool
+	url      string
+	path     string
+	port     int
+	secret   string
+	certFile string
+	keyFile  string
+}
+
+func newWebhookConfig(cfg config.TelegramConfig) webhookConfig {
+	return webhookConfig{
+		enabled:  cfg.TelegramMode == config.TelegramModeWebhook,
+		url:      strings.TrimSuffix(cfg.TelegramWebhookURL, "/") + cfg.TelegramWebhookPath,
+		path:     cfg.TelegramWebhookPath,
+		port:     cfg.TelegramWebhookPort,
+		secret:   cfg.TelegramWebhookSecret,
+		certFile: cfg.TelegramWebhookCertFile,
+		keyFile:  cfg.TelegramWebhookKeyFile,
+	}
+}
+
+// webhookHandler accepts the updates Telegram posts and passes them on.
+// Requests without the secret token set in setWebhook are rejected.
+func webhookHandler(secret string, updates chan<- tapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			slog.Warn("Rejected webhook request with wrong secret token", "remote", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var update tapi.Update
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			slog.Warn("Failed to decode webhook update", "error", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case updates <- update:
+		case <-r.Context().Done():
+			// Telegram retries updates that were not acknowledged.
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// startWebhook serves the webhook and registers it with Telegram. The
+// returned stop function removes the webhook and shuts the listener down.
+func (b *TelegramBot) startWebhook() (tapi.UpdatesChannel, func(), error) {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", b.webhook.port))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to listen for webhook: %v", err)
+	}
+
+	updates := make(chan tapi.Update, 100)
+	mux := http.NewServeMux()
+	mux.Handle(b.webhook.path, webhookHandler(b.webhook.secret, updates))
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		var err error
+		if b.webhook.certFile != "" {
+			err = srv.ServeTLS(ln, b.webhook.certFile, b.webhook.keyFile)
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Webhook listener failed", "error", err)
+		}
+	}()
+
+	_, err = b.bot.MakeRequest("setWebhook", tapi.Params{
+		"url":          b.webhook.url,
+		"secret_token": b.webhook.secret,
+	})
+	if err != nil {
+		srv.Close()
+		return nil, nil, fmt.Errorf("failed to set webhook: %v", err)
+	}
+	slog.Info("Webhook registered", "url", b.webhook.url, "addr", ln.Addr().String())
+
+	stop := func() {
+		if _, err := b.bot.Request(tapi.DeleteWebhookConfig{}); err != nil {
+			slog.Error("Failed to delete webhook", "error", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			slog.Error("Failed to shut down webhook listener", "error", err)
+		}
+	}
+	return updates, stop, nil
+}
@@ -0,0 +1,84 @@
+package telegram
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	testcases := []struct {
+		name     string
+		method   string
+		secret   string
+		body     string
+		expected int
+	}{
+		{name: "ok", method: http.MethodPost, secret: "s3cret", body: `{"update_id":7,"message":{"message_id":1,"chat":{"id":1},"text":"/start"}}`, expected: http.StatusOK},
+		{name: "wrong secret", method: http.MethodPost, secret: "guess", body: `{"update_id":7}`, expected: http.StatusUnauthorized},
+		{name: "missing secret", method: http.MethodPost, body: `{"update_id":7}`, expected: http.StatusUnauthorized},
+		{name: "wrong method", method: http.MethodGet, secret: "s3cret", expected: http.StatusMethodNotAllowed},
+		{name: "bad json", method: http.MethodPost, secret: "s3cret", body: `{`, expected: http.StatusBadRequest},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			updates := make(chan tapi.Update, 1)
+			req := httptest.NewRequest(tc.method, "/telegram/webhook", strings.NewReader(tc.body))
+			if tc.secret != "" {
+				req.Header.Set(secretTokenHeader, tc.secret)
+			}
+			rec := httptest.NewRecorder()
+
+			webhookHandler("s3cret", updates).ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expected, rec.Code)
+			if tc.expected == http.StatusOK {
+				update := <-updates
+				assert.Equal(t, 7, update.UpdateID)
+				assert.Equal(t, "/start", update.Message.Text)
+			} else {
+				assert.Empty(t, updates)
+			}
+		})
+	}
+}
+
+func TestRun_Webhook(t *testing.T) {
+	bot, api := newTestBot(t)
+	bot.webhook = newWebhookConfig(config.TelegramConfig{
+		TelegramMode:          config.TelegramModeWebhook,
+		TelegramWebhookURL:    "https://bot.example.com/",
+		TelegramWebhookPath:   "/telegram/webhook",
+		TelegramWebhookSecret: "s3cret",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- bot.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return len(api.Calls()) == 1 }, time.Second, 10*time.Millisecond)
+	call := api.Calls()[0]
+	assert.Equal(t, "setWebhook", call.Endpoint)
+	assert.Equal(t, "https://bot.example.com/telegram/webhook", call.Params["url"])
+	assert.Equal(t, "s3cret", call.Params["secret_token"])
+
+	cancel()
+	require.NoError(t, <-done)
+
+	var deleted bool
+	for _, req := range api.Requests() {
+		if _, ok := req.(tapi.DeleteWebhookConfig); ok {
+			deleted = true
+		}
+	}
+	assert.True(t, deleted)
+}
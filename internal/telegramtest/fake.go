@@ -0,0 +1,148 @@
+// Package telegramtest is an in-memory stand-in for the Telegram Bot API. It
+// records what the bot sends and lets tests inject updates.
+package telegramtest
+
+import (
+	"strings"
+	"sync"
+
+	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Sent is a message the bot sent.
+type Sent struct {
+	ChatID   int64
+	Text     string
+	Keyboard [][]tapi.InlineKeyboardButton
+}
+
+// Call is a raw MakeRequest call.
+type Call struct {
+	Endpoint string
+	Params   tapi.Params
+}
+
+type FakeBot struct {
+	// OnSend, when set, can fail a Send the way the Bot API would; failed
+	// sends are not recorded.
+	OnSend func(c tapi.Chattable) error
+
+	mux      sync.Mutex
+	nextID   int
+	sent     []Sent
+	requests []tapi.Chattable
+	calls    []Call
+	updates  chan tapi.Update
+}
+
+func NewFakeBot() *FakeBot {
+	return &FakeBot{updates: make(chan tapi.Update, 100)}
+}
+
+func (f *FakeBot) Send(c tapi.Chattable) (tapi.Message, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if f.OnSend != nil {
+		if err := f.OnSend(c); err != nil {
+			return tapi.Message{}, err
+		}
+	}
+
+	f.nextID++
+	msg := tapi.Message{MessageID: f.nextID}
+
+	if m, ok := c.(tapi.MessageConfig); ok {
+		s := Sent{ChatID: m.ChatID, Text: m.Text}
+		if kb, ok := m.ReplyMarkup.(tapi.InlineKeyboardMarkup); ok {
+			s.Keyboard = kb.InlineKeyboard
+		}
+		f.sent = append(f.sent, s)
+		msg.Chat = &tapi.Chat{ID: m.ChatID}
+		msg.Text = m.Text
+		return msg, nil
+	}
+
+	f.requests = append(f.requests, c)
+	return msg, nil
+}
+
+func (f *FakeBot) Request(c tapi.Chattable) (*tapi.APIResponse, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.requests = append(f.requests, c)
+	return &tapi.APIResponse{Ok: true}, nil
+}
+
+func (f *FakeBot) MakeRequest(endpoint string, params tapi.Params) (*tapi.APIResponse, error) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	f.calls = append(f.calls, Call{Endpoint: endpoint, Params: params})
+	return &tapi.APIResponse{Ok: true}, nil
+}
+
+func (f *FakeBot) GetUpdatesChan(config tapi.UpdateConfig) tapi.UpdatesChannel {
+	return f.updates
+}
+
+// Inject delivers an update to the bot as if it came from Telegram.
+func (f *FakeBot) Inject(update tapi.Update) {
+	f.updates <- update
+}
+
+// Sent returns the messages sent so far.
+func (f *FakeBot) Sent() []Sent {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]Sent(nil), f.sent...)
+}
+
+// Requests returns the non-message calls, e.g. setMyCommands or deleteMessage.
+func (f *FakeBot) Requests() []tapi.Chattable {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]tapi.Chattable(nil), f.requests...)
+}
+
+// Calls returns the MakeRequest calls, e.g. setWebhook.
+func (f *FakeBot) Calls() []Call {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// Reset forgets everything sent so far.
+func (f *FakeBot) Reset() {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.sent = nil
+	f.requests = nil
+	f.calls = nil
+}
+
+// Message builds an update with a text message; a leading "/" makes it a command.
+func Message(chatID int64, text string) tapi.Update {
+	msg := &tapi.Message{
+		MessageID: 1,
+		Chat:      &tapi.Chat{ID: chatID},
+		From:      &tapi.User{ID: chatID},
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command, _, _ := strings.Cut(text, " ")
+		msg.Entities = []tapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+	return tapi.Update{Message: msg}
+}
+
+// Callback builds an update with an inline keyboard press.
+func Callback(chatID int64, data string) tapi.Update {
+	return tapi.Update{CallbackQuery: &tapi.CallbackQuery{
+		ID:      "1",
+		From:    &tapi.User{ID: chatID},
+		Message: &tapi.Message{MessageID: 1, Chat: &tapi.Chat{ID: chatID}},
+		Data:    data,
+	}}
+}
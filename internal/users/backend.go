@@ -0,0 +1,145 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/service"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/storage"
+	"golang.org/x/time/rate"
+)
+
+// MoodleBackend builds grade services from the application config. The owner
+// uses the configured credentials and storage paths; every other user gets
+// their own Moodle session and a storage under USERS_DIR/<chat id>.
+type MoodleBackend struct {
+	cfg       *config.Config
+	badTitles []string
+	// limiter is shared by all users so the deployment as a whole stays
+	// within the configured request rate.
+	limiter *rate.Limiter
+}
+
+func NewMoodleBackend(cfg *config.Config, badTitles []string) *MoodleBackend {
+	return &MoodleBackend{
+		cfg:       cfg,
+		badTitles: badTitles,
+		limiter:   service.NewRateLimiter(cfg.MoodleConfig.MoodleRateLimit, cfg.MoodleConfig.MoodleRateBurst),
+	}
+}
+
+func (b *MoodleBackend) moodleConfig(u User) config.MoodleConfig {
+	mc := b.cfg.MoodleConfig
+	if !u.owner {
+		mc.MoodleUser = u.MoodleUser
+		mc.MoodlePass = u.MoodlePass
+		mc.MoodleToken = u.MoodleToken
+		if mc.MoodleCookieFile != "" {
+			mc.MoodleCookieFile = filepath.Join(b.userDir(u), "cookies.json")
+		}
+	}
+	return mc
+}
+
+func (b *MoodleBackend) Verify(ctx context.Context, u User) (User, error) {
+	mc := b.moodleConfig(u)
+
+	switch mc.MoodleSource {
+	case config.MoodleSourceWebService:
+		token, err := service.RequestWebServiceToken(ctx, mc, b.limiter, u.MoodleUser, u.MoodlePass)
+		if err != nil {
+			return u, err
+		}
+		u.MoodleToken = token
+		u.MoodlePass = ""
+	default:
+		// Log in from an empty jar, so a session saved for the chat earlier
+		// can't get in the way, and replace the saved one only once the
+		// login succeeded.
+		session := mc.MoodleCookieFile
+		if session != "" {
+			mc.MoodleCookieFile = session + ".login"
+			if err := removeFile(mc.MoodleCookieFile); err != nil {
+				return u, err
+			}
+		}
+
+		fetcher := service.NewMoodleFetcher(mc, b.limiter)
+		if err := fetcher.Login(ctx); err != nil {
+			return u, err
+		}
+		if err := fetcher.IsLogined(ctx); err != nil {
+			return u, service.ErrWrongCredentials
+		}
+
+		if session != "" {
+			if err := os.Rename(mc.MoodleCookieFile, session); err != nil {
+				slog.Warn("Failed to keep Moodle session", "chat", u.ChatID, "error", err)
+			}
+		}
+	}
+
+	return u, nil
+}
+
+// Forget removes the saved Moodle session of the user.
+func (b *MoodleBackend) Forget(u User) error {
+	mc := b.moodleConfig(u)
+	if u.owner || mc.MoodleCookieFile == "" {
+		return nil
+	}
+	return removeFile(mc.MoodleCookieFile)
+}
+
+func removeFile(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (b *MoodleBackend) NewService(u User) (*service.GradeService, error) {
+	mc := b.moodleConfig(u)
+
+	var source service.GradeSource
+	switch mc.MoodleSource {
+	case config.MoodleSourceWebService:
+		source = service.NewWebServiceSource(mc, b.limiter, b.badTitles)
+	default:
+		source = service.NewScrapeSource(service.NewMoodleFetcher(mc, b.limiter), b.badTitles)
+	}
+
+	store, err := b.newStorage(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.NewGradeService(source, store, mc.MoodleWorkers), nil
+}
+
+func (b *MoodleBackend) newStorage(u User) (storage.Storage, error) {
+	coursesDir, historyDir, sqlitePath := b.cfg.CsvFilesDir, b.cfg.HistoryDir, b.cfg.SQLitePath
+	if !u.owner {
+		dir := b.userDir(u)
+		coursesDir = filepath.Join(dir, "courses")
+		historyDir = filepath.Join(dir, "history")
+		sqlitePath = filepath.Join(dir, "grades.db")
+	}
+
+	switch b.cfg.StorageBackend {
+	case config.StorageSQLite:
+		return storage.NewSQLiteStorage(sqlitePath)
+	default:
+		return storage.NewCSVStorage(coursesDir, historyDir)
+	}
+}
+
+func (b *MoodleBackend) userDir(u User) string {
+	return filepath.Join(b.cfg.UsersDir, strconv.FormatInt(u.ChatID, 10))
+}
@@ -0,0 +1,51 @@
+package users
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/moodletest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoodleBackend_Session(t *testing.T) {
+	srv := moodletest.New(t, "student", "secret")
+	dir := t.TempDir()
+
+	cfg := &config.Config{
+		MoodleConfig:   srv.MoodleConfig(),
+		UsersDir:       filepath.Join(dir, "users"),
+		StorageBackend: config.StorageCSV,
+	}
+	cfg.MoodleConfig.MoodleCookieFile = "cookies.json"
+	cfg.MoodleConfig.MoodleCookieKey = "passphrase"
+
+	r, err := NewRegistry(filepath.Join(dir, "users.json"), "passphrase", NewMoodleBackend(cfg, nil))
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	ctx := context.Background()
+	session := filepath.Join(cfg.UsersDir, "5", "cookies.json")
+	user := User{ChatID: 5, MoodleUser: "student", MoodlePass: "secret"}
+
+	require.NoError(t, r.Register(ctx, user))
+	assert.FileExists(t, session)
+	assert.Equal(t, 1, srv.Logins())
+
+	// Logging in again while the saved session is still valid starts from a
+	// fresh one; Moodle would not show the login form to the old session.
+	require.NoError(t, r.Register(ctx, user))
+	assert.FileExists(t, session)
+	assert.Equal(t, 2, srv.Logins())
+
+	// A failed login keeps the session saved before.
+	user.MoodlePass = "wrong"
+	require.Error(t, r.Register(ctx, user))
+	assert.FileExists(t, session)
+
+	require.NoError(t, r.Unregister(5))
+	assert.NoFileExists(t, session)
+}
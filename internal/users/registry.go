@@ -0,0 +1,298 @@
+package users
+
+import (
+	"cmp"
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/service"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/pkg/utils"
+)
+
+var (
+	ErrNotRegistered = errors.New("❗️ you are not logged in, use /login first")
+	ErrNoUsersKey    = errors.New("❗️ this bot can't keep Moodle passwords, ask its owner to set USERS_KEY")
+)
+
+// User is a Telegram chat with its own Moodle account. Depending on the grade
+// source either the password or a web service token is kept.
+type User struct {
+	ChatID     int64  `json:"chat_id"`
+	MoodleUser string `json:"moodle_user"`
+	// MoodlePass is only written encrypted, as SealedPass.
+	MoodlePass  string    `json:"-"`
+	SealedPass  string    `json:"moodle_pass_sealed,omitempty"`
+	MoodleToken string    `json:"moodle_token,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// owner is the account configured in .env; it is never written to the
+	// registry file.
+	owner bool
+}
+
+// Backend checks Moodle credentials and builds the isolated grade service of a user.
+type Backend interface {
+	Verify(ctx context.Context, u User) (User, error)
+	NewService(u User) (*service.GradeService, error)
+	// Forget removes what is kept for the user besides the grades, such as
+	// the saved Moodle session.
+	Forget(u User) error
+}
+
+// Registry keeps the registered users, persisted as JSON, and their grade services.
+type Registry struct {
+	mux  sync.RWMutex
+	path string
+	// aead encrypts the passwords in the file; without it users can only
+	// log in with a web service token.
+	aead     cipher.AEAD
+	backend  Backend
+	users    map[int64]User
+	services map[int64]*service.GradeService
+}
+
+// NewRegistry loads the users saved at path. key encrypts their passwords;
+// when it is empty only token based logins are kept.
+func NewRegistry(path, key string, backend Backend) (*Registry, error) {
+	r := &Registry{
+		path:     path,
+		backend:  backend,
+		users:    map[int64]User{},
+		services: map[int64]*service.GradeService{},
+	}
+	if key != "" {
+		aead, err := utils.NewAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		r.aead = aead
+	}
+
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %v", err)
+	}
+
+	var stored []User
+	if err := json.Unmarshal(buf, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse users file: %v", err)
+	}
+
+	for _, u := range stored {
+		if err := r.openPass(&u); err != nil {
+			slog.Error("Failed to decrypt password of user, they must /login again", "chat", u.ChatID, "error", err)
+			continue
+		}
+		svc, err := backend.NewService(u)
+		if err != nil {
+			slog.Error("Failed to create service for user", "chat", u.ChatID, "error", err)
+			continue
+		}
+		r.users[u.ChatID] = u
+		r.services[u.ChatID] = svc
+	}
+	slog.Info("Loaded users", "count", len(r.users))
+
+	return r, nil
+}
+
+// AddOwner registers the account configured in .env without persisting it.
+func (r *Registry) AddOwner(chatID int64) error {
+	u := User{ChatID: chatID, owner: true}
+	svc, err := r.backend.NewService(u)
+	if err != nil {
+		return err
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.users[chatID] = u
+	r.services[chatID] = svc
+	return nil
+}
+
+func (r *Registry) IsOwner(chatID int64) bool {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.users[chatID].owner
+}
+
+// Register verifies the credentials against Moodle and stores the user,
+// replacing a previous registration of the same chat.
+func (r *Registry) Register(ctx context.Context, u User) error {
+	if r.IsOwner(u.ChatID) {
+		return errors.New("❗️ the owner account is configured in .env")
+	}
+
+	u, err := r.backend.Verify(ctx, u)
+	if err != nil {
+		return err
+	}
+	if u.MoodlePass != "" && r.aead == nil {
+		return ErrNoUsersKey
+	}
+	u.CreatedAt = time.Now()
+
+	svc, err := r.backend.NewService(u)
+	if err != nil {
+		return err
+	}
+
+	r.mux.Lock()
+	old := r.services[u.ChatID]
+	r.users[u.ChatID] = u
+	r.services[u.ChatID] = svc
+	err = r.save()
+	r.mux.Unlock()
+
+	if old != nil {
+		closeService(u.ChatID, old)
+	}
+	return err
+}
+
+// Unregister forgets the credentials and the Moodle session of a chat.
+// Stored grades are kept.
+func (r *Registry) Unregister(chatID int64) error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	u, ok := r.users[chatID]
+	if !ok {
+		return ErrNotRegistered
+	}
+	if u.owner {
+		return errors.New("❗️ the owner account is configured in .env")
+	}
+
+	svc := r.services[chatID]
+	delete(r.users, chatID)
+	delete(r.services, chatID)
+	closeService(chatID, svc)
+
+	if err := r.backend.Forget(u); err != nil {
+		slog.Error("Failed to forget user", "chat", chatID, "error", err)
+	}
+	return r.save()
+}
+
+// closeService closes a replaced or removed service once its running sync,
+// if any, is done, without holding up the caller.
+func closeService(chatID int64, svc *service.GradeService) {
+	go func() {
+		if err := svc.Close(); err != nil {
+			slog.Error("Failed to close grade service", "chat", chatID, "error", err)
+		}
+	}()
+}
+
+func (r *Registry) Service(chatID int64) (*service.GradeService, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	svc, ok := r.services[chatID]
+	if !ok {
+		return nil, ErrNotRegistered
+	}
+	return svc, nil
+}
+
+func (r *Registry) ChatIDs() []int64 {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+
+	ids := make([]int64, 0, len(r.users))
+	for id := range r.users {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (r *Registry) Close() error {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	var errs []error
+	for _, svc := range r.services {
+		errs = append(errs, svc.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// save must be called with the lock held.
+func (r *Registry) save() error {
+	stored := make([]User, 0, len(r.users))
+	for _, u := range r.users {
+		if u.owner {
+			continue
+		}
+		if err := r.sealPass(&u); err != nil {
+			return err
+		}
+		stored = append(stored, u)
+	}
+	slices.SortFunc(stored, func(a, b User) int { return cmp.Compare(a.ChatID, b.ChatID) })
+
+	buf, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+	// The file holds Moodle tokens and encrypted passwords.
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, buf, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+func (r *Registry) sealPass(u *User) error {
+	if u.MoodlePass == "" {
+		return nil
+	}
+	if r.aead == nil {
+		return ErrNoUsersKey
+	}
+	sealed, err := utils.Seal(r.aead, []byte(u.MoodlePass))
+	if err != nil {
+		return err
+	}
+	u.SealedPass = base64.StdEncoding.EncodeToString(sealed)
+	return nil
+}
+
+func (r *Registry) openPass(u *User) error {
+	if u.SealedPass == "" {
+		return nil
+	}
+	if r.aead == nil {
+		return ErrNoUsersKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(u.SealedPass)
+	if err != nil {
+		return err
+	}
+	pass, err := utils.Open(r.aead, sealed)
+	if err != nil {
+		return err
+	}
+	u.MoodlePass = string(pass)
+	return nil
+}
@@ -0,0 +1,84 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/service"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeBackend struct {
+	dir string
+}
+
+func (f fakeBackend) Verify(ctx context.Context, u User) (User, error) {
+	if u.MoodlePass != "secret" {
+		return u, service.ErrWrongCredentials
+	}
+	return u, nil
+}
+
+func (f fakeBackend) Forget(u User) error {
+	return nil
+}
+
+func (f fakeBackend) NewService(u User) (*service.GradeService, error) {
+	store, err := storage.NewCSVStorage(filepath.Join(f.dir, "courses"), filepath.Join(f.dir, "history"))
+	if err != nil {
+		return nil, err
+	}
+	return service.NewGradeService(nil, store, 1), nil
+}
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.json")
+	backend := fakeBackend{dir: dir}
+
+	r, err := NewRegistry(path, "passphrase", backend)
+	require.NoError(t, err)
+	require.NoError(t, r.AddOwner(1))
+
+	err = r.Register(context.Background(), User{ChatID: 2, MoodleUser: "student", MoodlePass: "wrong"})
+	assert.True(t, errors.Is(err, service.ErrWrongCredentials))
+
+	require.NoError(t, r.Register(context.Background(), User{ChatID: 2, MoodleUser: "student", MoodlePass: "secret"}))
+	require.Error(t, r.Register(context.Background(), User{ChatID: 1, MoodleUser: "owner", MoodlePass: "secret"}))
+	assert.Equal(t, []int64{1, 2}, r.ChatIDs())
+
+	buf, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(buf), "secret", "passwords are encrypted")
+
+	// Only registered users are persisted, the owner comes from the config.
+	r, err = NewRegistry(path, "passphrase", backend)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, r.ChatIDs())
+	assert.Equal(t, "secret", r.users[2].MoodlePass)
+
+	// A wrong key drops the user instead of logging in with garbage.
+	other, err := NewRegistry(path, "other", backend)
+	require.NoError(t, err)
+	assert.Empty(t, other.ChatIDs())
+
+	require.NoError(t, r.Unregister(2))
+	_, err = r.Service(2)
+	assert.ErrorIs(t, err, ErrNotRegistered)
+	assert.ErrorIs(t, r.Unregister(2), ErrNotRegistered)
+}
+
+func TestRegistry_NoKey(t *testing.T) {
+	dir := t.TempDir()
+	r, err := NewRegistry(filepath.Join(dir, "users.json"), "", fakeBackend{dir: dir})
+	require.NoError(t, err)
+
+	err = r.Register(context.Background(), User{ChatID: 2, MoodleUser: "student", MoodlePass: "secret"})
+	assert.ErrorIs(t, err, ErrNoUsersKey)
+	assert.Empty(t, r.ChatIDs())
+}
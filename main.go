@@ -10,49 +10,132 @@ import (
 	"syscall"
 
 	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/config"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/model"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/notify"
 	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/scheduler"
-	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/service"
-	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/storage"
 	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/telegram"
+	"github.com/TheTeemka/telegram_bot_moodle_grades/internal/users"
 	"github.com/TheTeemka/telegram_bot_moodle_grades/pkg/logging"
+	tapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 func main() {
+	if err := run(); err != nil {
+		slog.Error("Bot stopped", "error", err)
+		os.Exit(1)
+	}
+}
+
+// run starts the bot and the background sync and blocks until a shutdown
+// signal or a failure of the bot, after which everything is shut down in
+// order.
+func run() error {
 	debugFlag := flag.Bool("debug", false, "enable debug mode")
+	recordFlag := flag.String("record", "", "save every Moodle response to `dir`, with secrets redacted")
+	replayFlag := flag.String("replay", "", "serve Moodle responses from a recording in `dir` instead of the network")
 	flag.Parse()
 	logging.SetSlog(*debugFlag)
 
 	cfg := config.Load()
+	if *recordFlag != "" && *replayFlag != "" {
+		panic("--record and --replay cannot be used together")
+	}
+	if *recordFlag != "" {
+		cfg.MoodleConfig.MoodleRecordDir = *recordFlag
+	}
+	if *replayFlag != "" {
+		cfg.MoodleConfig.MoodleReplayDir = *replayFlag
+		// Replayed cookies are redacted, they must not replace a real session.
+		cfg.MoodleConfig.MoodleCookieFile = ""
+	}
+
+	slog.Info("Starting telegram bot", "debug", *debugFlag, "record", cfg.MoodleConfig.MoodleRecordDir, "replay", cfg.MoodleConfig.MoodleReplayDir)
 
-	slog.Info("Starting telegram bot", "debug", *debugFlag)
+	registry, err := users.NewRegistry(cfg.UsersFile, cfg.UsersKey, users.NewMoodleBackend(cfg, badTitles))
+	if err != nil {
+		panic(err)
+	}
+	defer registry.Close()
 
-	fetcher := service.NewMoodleFetcher(cfg.MoodleConfig)
-	csvWriter := storage.NewCSVWriter(cfg.CsvFilesDir)
-	gradeService := service.NewGradeService(fetcher, csvWriter, badTitles)
+	err = registry.AddOwner(cfg.TelegramConfig.TelegramID)
+	if err != nil {
+		panic(err)
+	}
+	slog.Info("Using grade source", "source", cfg.MoodleConfig.MoodleSource, "storage", cfg.StorageBackend)
 
 	var wg sync.WaitGroup
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	ownerNotifiers := notify.FromConfig(cfg.NotifyConfig)
+	slog.Info("Extra notification channels", "count", len(ownerNotifiers))
+
+	quietHours, err := notify.ParseWindow(cfg.QuietHours)
+	if err != nil {
+		panic(err)
+	}
+	heldChanges, err := notify.NewHeldStore(cfg.QuietHoursFile)
+	if err != nil {
+		panic(err)
+	}
 
-	bot := telegram.NewTelegramBot(cfg.TelegramConfig, gradeService)
+	gpaScale, err := model.ParseGradeScale(cfg.GPAScale)
+	if err != nil {
+		panic(err)
+	}
+	gpaCredits, err := model.ParseCredits(cfg.GPACredits)
+	if err != nil {
+		panic(err)
+	}
+	gpa := model.GPAConfig{Scale: gpaScale, Credits: gpaCredits, DefaultCredits: cfg.GPADefaultCredits}
+
+	botAPI, err := tapi.NewBotAPI(cfg.TelegramConfig.TelegramToken)
+	if err != nil {
+		panic(err)
+	}
+
+	bot := telegram.NewTelegramBot(botAPI, telegram.Options{
+		Config:          cfg.TelegramConfig,
+		Users:           registry,
+		SyncConcurrency: cfg.SyncConcurrency,
+		SyncTimeout:     cfg.SyncTimeout,
+		OwnerNotifiers:  ownerNotifiers,
+		QuietHours:      quietHours,
+		HeldChanges:     heldChanges,
+		GPA:             gpa,
+	})
+	// A failing bot, e.g. a webhook that can't be set up, shuts everything
+	// down like a signal does.
+	var botErr error
 	wg.Go(func() {
-		bot.Run(ctx)
+		if err := bot.Run(ctx); err != nil {
+			slog.Error("Bot failed, shutting down", "error", err)
+			botErr = err
+			cancel()
+		}
 	})
 	slog.Info("Bot started")
 
-	scheduler := scheduler.NewSyncScheduler(cfg.SyncInterval, bot.HandleSync)
+	var schedule scheduler.Schedule = scheduler.Every(cfg.SyncInterval)
+	if cfg.SyncSchedule != "" {
+		schedule, err = scheduler.ParseCron(cfg.SyncSchedule)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	scheduler := scheduler.NewSyncScheduler(schedule, bot.HandleSync)
 	wg.Go(func() {
 		scheduler.Run(ctx)
 	})
-	slog.Info("Background sync started", "interval", cfg.SyncInterval.String())
-
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	slog.Info("Background sync started", "interval", cfg.SyncInterval.String(), "schedule", cfg.SyncSchedule, "quiet_hours", cfg.QuietHours)
 
-	slog.Info("Received shutdown signal, exiting...")
+	<-ctx.Done()
+	slog.Info("Shutting down...")
 	cancel()
 	wg.Wait()
 	slog.Info("Shutdown down.")
+	return botErr
 }
 
 var badTitles = []string{